@@ -6,6 +6,7 @@ import (
 	"expvar"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,11 +16,17 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/rpstvs/social/internal/auth"
+	"github.com/rpstvs/social/internal/blobstore"
+	"github.com/rpstvs/social/internal/cursor"
 	"github.com/rpstvs/social/internal/ratelimiter"
+	"github.com/rpstvs/social/internal/search"
 	"github.com/rpstvs/social/internal/store"
 	"github.com/rpstvs/social/internal/store/cache"
+	"github.com/rpstvs/social/internal/timeline"
+	"github.com/rpstvs/social/internal/trending"
 	HttpSwagger "github.com/swaggo/http-swagger/v2"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 type application struct {
@@ -29,6 +36,20 @@ type application struct {
 	logger        *zap.SugaredLogger
 	authenticator auth.Authenticator
 	rateLimiter   ratelimiter.Limiter
+	// anonRateLimiter counts anonymous requests to public routes.
+	anonRateLimiter ratelimiter.Limiter
+	blobStore       blobstore.Store
+	trending        trending.Store
+	// cursors signs the pagination cursors handed out to clients.
+	cursors *cursor.Signer
+	// timelines holds the home timelines when redis is enabled; the feed is
+	// computed in SQL otherwise.
+	timelines    *timeline.Store
+	timelineJobs chan timelineJob
+	searchIndex  search.Index
+	// userLoads coalesces the concurrent database reads of a user missing
+	// from the cache.
+	userLoads singleflight.Group
 }
 
 type config struct {
@@ -39,7 +60,20 @@ type config struct {
 	mail        mailConfig
 	authConfig  AuthConfig
 	redisCfg    RedisConfig
+	cache       CacheConfig
 	rateLimiter ratelimiter.Config
+	scheduler   SchedulerConfig
+	trash       TrashConfig
+	media       MediaConfig
+	trending    TrendingConfig
+	timeline    TimelineConfig
+	search      SearchConfig
+	// trustedProxies are the peers whose X-Forwarded-For and X-Real-IP
+	// headers are believed.
+	trustedProxies []netip.Prefix
+	// requireIfMatch rejects post updates and deletes sent without an
+	// If-Match header instead of applying them unconditionally.
+	requireIfMatch bool
 }
 
 type AuthConfig struct {
@@ -64,6 +98,82 @@ type RedisConfig struct {
 	enabled  bool
 }
 
+// CacheConfig selects where users and posts are cached: "redis", with an
+// in-process tier of localSize entries kept for localTTL in front of it, or
+// "memory", holding up to memorySize entries per kind in process.
+type CacheConfig struct {
+	enabled    bool
+	backend    string
+	localSize  int
+	localTTL   time.Duration
+	memorySize int
+}
+
+type SchedulerConfig struct {
+	enabled   bool
+	interval  time.Duration
+	batchSize int
+}
+
+type TrashConfig struct {
+	retention      time.Duration
+	purgeEnabled   bool
+	purgeInterval  time.Duration
+	purgeBatchSize int
+}
+
+type TrendingConfig struct {
+	enabled  bool
+	interval time.Duration
+}
+
+type TimelineConfig struct {
+	workers   int
+	queueSize int
+	// capacity is the number of posts kept per timeline.
+	capacity int
+	// celebrityThreshold is the follower count from which the posts of an
+	// account are pulled by its followers instead of pushed to them.
+	celebrityThreshold int
+	ttl                time.Duration
+}
+
+// SearchConfig drives the worker applying the search outbox to the index.
+type SearchConfig struct {
+	syncEnabled   bool
+	syncInterval  time.Duration
+	syncBatchSize int
+	syncLease     time.Duration
+}
+
+type MediaConfig struct {
+	backend         string
+	localRoot       string
+	s3              S3Config
+	processing      ImageProcessingConfig
+	maxImageSize    int64
+	maxVideoSize    int64
+	orphanTTL       time.Duration
+	cleanupInterval time.Duration
+}
+
+type ImageProcessingConfig struct {
+	workers  int
+	interval time.Duration
+	lease    time.Duration
+	// maxPixels rejects images whose header announces more pixels than
+	// this, before decoding them.
+	maxPixels int
+}
+
+type S3Config struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
 type mailConfig struct {
 	exp time.Duration
 }
@@ -119,6 +229,92 @@ func NewApplication(config config, storage store.Storage, cacheStorage cache.Sto
 		cacheStorage:  cacheStorage,
 		logger:        logger,
 		authenticator: auth.NewJwtAuthenticator(config.authConfig.token.secret, "gopherSocial", "gopherSocial"),
+		cursors:       cursor.NewSigner(config.authConfig.token.secret),
+	}
+}
+
+func NewCacheConfig(enabled bool, backend string, localSize int, localTTL time.Duration, memorySize int) CacheConfig {
+	return CacheConfig{
+		enabled:    enabled,
+		backend:    backend,
+		localSize:  localSize,
+		localTTL:   localTTL,
+		memorySize: memorySize,
+	}
+}
+
+func NewSchedulerConfig(enabled bool, interval time.Duration, batchSize int) SchedulerConfig {
+	return SchedulerConfig{
+		enabled:   enabled,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func NewTrashConfig(retention time.Duration, purgeEnabled bool, purgeInterval time.Duration, purgeBatchSize int) TrashConfig {
+	return TrashConfig{
+		retention:      retention,
+		purgeEnabled:   purgeEnabled,
+		purgeInterval:  purgeInterval,
+		purgeBatchSize: purgeBatchSize,
+	}
+}
+
+func NewTrendingConfig(enabled bool, interval time.Duration) TrendingConfig {
+	return TrendingConfig{
+		enabled:  enabled,
+		interval: interval,
+	}
+}
+
+func NewTimelineConfig(workers, queueSize, capacity, celebrityThreshold int, ttl time.Duration) TimelineConfig {
+	return TimelineConfig{
+		workers:            workers,
+		queueSize:          queueSize,
+		capacity:           capacity,
+		celebrityThreshold: celebrityThreshold,
+		ttl:                ttl,
+	}
+}
+
+func NewSearchConfig(syncEnabled bool, syncInterval time.Duration, syncBatchSize int, syncLease time.Duration) SearchConfig {
+	return SearchConfig{
+		syncEnabled:   syncEnabled,
+		syncInterval:  syncInterval,
+		syncBatchSize: syncBatchSize,
+		syncLease:     syncLease,
+	}
+}
+
+func NewMediaConfig(backend, localRoot string, s3 S3Config, processing ImageProcessingConfig, maxImageSize, maxVideoSize int64, orphanTTL, cleanupInterval time.Duration) MediaConfig {
+	return MediaConfig{
+		backend:         backend,
+		localRoot:       localRoot,
+		s3:              s3,
+		processing:      processing,
+		maxImageSize:    maxImageSize,
+		maxVideoSize:    maxVideoSize,
+		orphanTTL:       orphanTTL,
+		cleanupInterval: cleanupInterval,
+	}
+}
+
+func NewImageProcessingConfig(workers int, interval, lease time.Duration, maxPixels int) ImageProcessingConfig {
+	return ImageProcessingConfig{
+		workers:   workers,
+		interval:  interval,
+		lease:     lease,
+		maxPixels: maxPixels,
+	}
+}
+
+func NewS3Config(endpoint, bucket, region, accessKey, secretKey string) S3Config {
+	return S3Config{
+		endpoint:  endpoint,
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
 	}
 }
 
@@ -133,16 +329,16 @@ func (app *application) mount() http.Handler {
 
 	// A good base middleware stack
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.RealIPMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -164,30 +360,86 @@ func (app *application) mount() http.Handler {
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware())
 			r.Post("/", app.CreatePostHandler)
+			r.Get("/drafts", app.getDraftsHandler)
 
-			r.Route("/{postsID}", func(r chi.Router) {
+			r.Route("/{postID}", func(r chi.Router) {
 
 				r.Use(app.postsContextMiddleware)
 
 				r.Get("/", app.GetPostHandler)
-				r.Patch("/", app.checkPostOwnership("moderator", app.UpdatePostHandler))
-				r.Delete("/", app.checkPostOwnership("admin", app.DeletePostHandler))
-
+				r.Patch("/", app.checkPostOwnership("moderator", app.checkPostPrecondition(app.UpdatePostHandler)))
+				r.Delete("/", app.checkPostOwnership("admin", app.checkPostPrecondition(app.DeletePostHandler)))
+
+				r.Route("/revisions", func(r chi.Router) {
+					r.Get("/", app.getPostRevisionsHandler)
+					r.Get("/{version}", app.getPostRevisionHandler)
+					r.Post("/{version}/restore", app.checkPostOwnership("moderator", app.restorePostRevisionHandler))
+				})
+
+				r.Get("/comments", app.getPostCommentsHandler)
+				r.Post("/publish", app.checkPostOwnership("admin", app.publishPostHandler))
+				r.Post("/poll/votes", app.votePollHandler)
+				r.Post("/repost", app.RepostHandler)
+				r.Delete("/repost", app.UnrepostHandler)
+
+				r.Put("/bookmark", app.bookmarkPostHandler)
+				r.Delete("/bookmark", app.unbookmarkPostHandler)
 			})
 
 		})
 
+		r.With(app.OptionalAuthTokenMiddleware()).Get("/media/*", app.serveMediaHandler)
+		r.With(app.AuthTokenMiddleware()).Post("/media", app.uploadMediaHandler)
+
+		r.Route("/trash", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware())
+			r.Get("/", app.getTrashHandler)
+			r.Post("/{postID}/restore", app.restorePostHandler)
+		})
+
+		// read-only routes also open to logged-out visitors
+		r.Group(func(r chi.Router) {
+			r.Use(app.OptionalAuthTokenMiddleware())
+			r.Use(app.AnonymousRateLimiterMiddleware)
+			r.Get("/timeline/public", app.getPublicTimelineHandler)
+			r.Get("/explore/trending", app.exploreTrendingHandler)
+			r.Get("/search", app.searchHandler)
+		})
+
+		r.Route("/tags/{tag}", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware())
+			r.Get("/", app.getTagHandler)
+			r.Get("/posts", app.getTagPostsHandler)
+			r.Put("/follow", app.followTagHandler)
+			r.Delete("/follow", app.unfollowTagHandler)
+		})
+
+		r.Route("/bookmarks", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware())
+			r.Get("/", app.getBookmarksHandler)
+
+			r.Route("/collections", func(r chi.Router) {
+				r.Get("/", app.getBookmarkCollectionsHandler)
+				r.Post("/", app.createBookmarkCollectionHandler)
+				r.Delete("/{collectionID}", app.deleteBookmarkCollectionHandler)
+			})
+		})
+
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{activate}", app.activateUserHandler)
-			r.Route("/{userid}", func(r chi.Router) {
+			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware())
 				r.Get("/", app.getUserHandler)
+				r.Get("/followers", app.getFollowersHandler)
+				r.Get("/following", app.getFollowingHandler)
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware())
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/mentions", app.getMentionsHandler)
+				r.Put("/avatar", app.setAvatarHandler)
 			})
 		})
 
@@ -213,6 +465,19 @@ func (app *application) run(mux http.Handler) error {
 
 	shutdown := make(chan error)
 
+	// background jobs stop as soon as a shutdown signal is caught
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go app.runPostScheduler(jobsCtx)
+	go app.runTrashPurger(jobsCtx)
+	go app.runMediaJanitor(jobsCtx)
+	go app.runMediaProcessor(jobsCtx)
+	go app.runTrendingJob(jobsCtx)
+	go app.runTimelineWorkers(jobsCtx)
+	go app.runSearchSync(jobsCtx)
+	go app.runCacheListener(jobsCtx)
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -226,6 +491,8 @@ func (app *application) run(mux http.Handler) error {
 
 		app.logger.Infow("signal caught", "signal", s.String())
 
+		stopJobs()
+
 		shutdown <- srv.Shutdown(ctx)
 	}()
 
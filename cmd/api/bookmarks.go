@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rpstvs/social/internal/store"
+)
+
+type CreateBookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type BookmarkPostPayload struct {
+	CollectionID *int64 `json:"collection_id"`
+}
+
+func (app *application) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkCollectionPayload
+
+	if err := ReadJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	collection := &store.BookmarkCollection{
+		UserID: user.ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	collections, err := app.store.Bookmarks.GetCollections(r.Context(), user.ID)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	collectionID, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), user.ID, collectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var collectionID *int64
+
+	if param := r.URL.Query().Get("collection"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		collectionID = &id
+	}
+
+	user := getUserFromContext(r)
+
+	bookmarks, err := app.store.Bookmarks.GetBookmarks(r.Context(), user.ID, collectionID, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, bookmarks); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) bookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BookmarkPostPayload
+
+	if r.ContentLength != 0 {
+		if err := ReadJson(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	user := getUserFromContext(r)
+	post := getPostfromCtx(r)
+
+	if err := app.store.Bookmarks.Add(r.Context(), user.ID, post.ID, payload.CollectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unbookmarkPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostfromCtx(r)
+
+	if err := app.store.Bookmarks.Remove(r.Context(), user.ID, post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rpstvs/social/internal/store/cache"
+)
+
+func newCacheStorage(cfg CacheConfig, rdb *redis.Client) (cache.Storage, error) {
+	if !cfg.enabled {
+		return cache.Storage{}, nil
+	}
+
+	switch cfg.backend {
+	case "redis":
+		if rdb == nil {
+			return cache.Storage{}, fmt.Errorf("the redis cache backend needs redis to be enabled")
+		}
+		return cache.NewRedisStorage(rdb, cfg.localSize, cfg.localTTL), nil
+	case "memory":
+		return cache.NewMemoryStorage(cfg.memorySize), nil
+	default:
+		return cache.Storage{}, fmt.Errorf("unknown cache backend %q", cfg.backend)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+// postStatus derives the status of a new or unpublished post. A publish time
+// schedules it, otherwise it is either kept as a draft or published now.
+func postStatus(draft bool, publishAt *time.Time) (string, *string, error) {
+	if publishAt != nil {
+		if !publishAt.After(time.Now()) {
+			return "", nil, fmt.Errorf("publish_at must be in the future")
+		}
+
+		at := publishAt.UTC().Format(time.RFC3339)
+		return store.StatusScheduled, &at, nil
+	}
+
+	if draft {
+		return store.StatusDraft, nil, nil
+	}
+
+	return store.StatusPublished, nil, nil
+}
+
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), user.ID, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, drafts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostfromCtx(r)
+	user := getUserFromContext(r)
+
+	if post.Status == store.StatusPublished {
+		app.badRequestResponse(w, r, fmt.Errorf("post is already published"))
+		return
+	}
+
+	post.Status = store.StatusPublished
+	post.PublishAt = nil
+	post.EditorID = user.ID
+
+	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateCachedPost(r.Context(), post.ID, post.Version)
+	app.pushToTimelines(post.ID)
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// runPostScheduler publishes due scheduled posts until ctx is cancelled.
+// Every API instance runs it; PublishDue makes sure each post is claimed once.
+func (app *application) runPostScheduler(ctx context.Context) {
+	if !app.config.scheduler.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ids, err := app.store.Posts.PublishDue(ctx, app.config.scheduler.batchSize)
+
+			if err != nil {
+				app.logger.Errorw("couldnt publish scheduled posts", "error", err)
+				continue
+			}
+
+			if len(ids) > 0 {
+				app.logger.Infow("published scheduled posts", "ids", ids)
+			}
+
+			for _, id := range ids {
+				app.pushToTimelines(id)
+			}
+		}
+	}
+}
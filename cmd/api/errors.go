@@ -43,6 +43,30 @@ func (app *application) UnauthorizedBasicErrorResponse(w http.ResponseWriter, r
 	RespondWithError(http.StatusUnauthorized, w, "unauthorized")
 }
 
+func (app *application) payloadTooLargeResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnf("payload too large", "method", r.Method, "path", r.URL.Path, "error", err)
+	RespondWithError(http.StatusRequestEntityTooLarge, w, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnf("unsupported media type", "method", r.Method, "path", r.URL.Path, "error", err)
+	RespondWithError(http.StatusUnsupportedMediaType, w, err.Error())
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnf("precondition failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	RespondWithError(http.StatusPreconditionFailed, w, err.Error())
+}
+
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnf("precondition required", "method", r.Method, "path", r.URL.Path, "error", err)
+	RespondWithError(http.StatusPreconditionRequired, w, err.Error())
+}
+
 func (app *application) rateLimitExceedResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
 
 	app.logger.Warnf("rate limit exceeded", "method", r.Method, "path", r.URL.Path, "error", retryAfter)
@@ -51,3 +75,9 @@ func (app *application) rateLimitExceedResponse(w http.ResponseWriter, r *http.R
 
 	RespondWithError(http.StatusTooManyRequests, w, retryAfter)
 }
+
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	app.logger.Warnf("conflict", "method", r.Method, "path", r.URL.Path, "error", err)
+	RespondWithError(http.StatusConflict, w, err.Error())
+}
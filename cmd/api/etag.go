@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+// postRepresentation loads the parts served along with the post to the
+// viewer, its comments and bookmark, and encodes the whole. The strong entity
+// tag returned digests the encoding, so it changes with the post and with
+// any embedded part: comments, bookmark, repost count, poll tallies or media.
+func (app *application) postRepresentation(ctx context.Context, post *store.Post, viewerID int64) ([]byte, string, error) {
+	comments, err := app.store.Comments.GetById(ctx, post.ID)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	post.Comments = *comments
+
+	post.Bookmarked, err = app.store.Bookmarks.IsBookmarked(ctx, viewerID, post.ID)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, err := json.Marshal(post)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(body)
+
+	return body, fmt.Sprintf(`"%d-%s-%x"`, post.ID, post.Version, sum[:8]), nil
+}
+
+// writeRepresentation sends a representation built by postRepresentation.
+// It varies with the viewer.
+func writeRepresentation(w http.ResponseWriter, status int, body []byte, etag string) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Authorization")
+	w.WriteHeader(status)
+
+	_, err := w.Write(body)
+
+	return err
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header value. A "*" matches any existing representation. Weak tags only
+// match under weak comparison, which If-None-Match uses and If-Match must
+// not.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPostPrecondition guards writes on the post from the context with
+// If-Match. A stale tag is rejected with 412 and, when the configuration
+// requires it, a missing header with 428. The check is repeated by the write
+// itself, which only applies to the version of the post checked here.
+func (app *application) checkPostPrecondition(handler http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		post := getPostfromCtx(r)
+		user := getUserFromContext(r)
+		ifMatch := r.Header.Get("If-Match")
+
+		if ifMatch == "" {
+			if app.config.requireIfMatch {
+				app.preconditionRequiredResponse(w, r, fmt.Errorf("If-Match header missing"))
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		_, etag, err := app.postRepresentation(r.Context(), post, user.ID)
+
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !etagMatches(ifMatch, etag, false) {
+			w.Header().Set("ETag", etag)
+			app.preconditionFailedResponse(w, r, fmt.Errorf("post has been modified"))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"1-3-0a1b2c3d4e5f6071"`
+
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"same tag", etag, false, true},
+		{"another tag", `"1-2-0a1b2c3d4e5f6071"`, false, false},
+		{"listed among others", `"a", ` + etag + ` ,"b"`, false, true},
+		{"any representation", "*", false, true},
+		{"weak tag under strong comparison", "W/" + etag, false, false},
+		{"weak tag under weak comparison", "W/" + etag, true, true},
+		{"unquoted tag", "1-3-0a1b2c3d4e5f6071", true, false},
+		{"empty header", "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, etag, tt.weak); got != tt.want {
+				t.Errorf("etagMatches(%q, weak = %v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+			}
+		})
+	}
+}
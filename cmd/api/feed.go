@@ -1,40 +1,109 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 
-	"github.com/rpstvs/social/internal/store"
+	"github.com/rpstvs/social/internal/cursor"
 )
 
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
-	//pagination, search, filters
+	fq, err := app.readPageQuery(w, r, "desc")
 
-	fq := store.PaginatedFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	switch r.URL.Query().Get("mode") {
+	case "", "chronological":
+	case "ranked":
+		app.getRankedFeed(w, r, user, fq)
+		return
+	default:
+		app.badRequestResponse(w, r, errors.New("mode must be chronological or ranked"))
+		return
+	}
+
+	// the redis timelines only hold the unfiltered feed, newest first
+	if app.timelines != nil && fq.Sort == "desc" && fq.Offset == 0 && fq.Search == "" && len(fq.Tags) == 0 {
+		feed, page, ok, err := app.readTimeline(r.Context(), user.ID, fq)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, cursor.ErrInvalid):
+				app.badRequestResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if ok {
+			if err := app.paginatedResponse(w, r, http.StatusOK, feed, page); err != nil {
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	feed, page, err := app.store.Posts.GetUserFeed(r.Context(), user.ID, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
 
-	fq, err := fq.Parse(r)
+	if err := app.paginatedResponse(w, r, http.StatusOK, feed, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMentionsHandler lists the posts that @mention the authenticated user.
+func (app *application) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.readPageQuery(w, r, "desc")
 
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if err := Validate.Struct(fq); err != nil {
+	user := getUserFromContext(r)
+
+	posts, page, err := app.store.Posts.GetMentioning(r.Context(), user.ID, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getPublicTimelineHandler lists every public post. It is open to anonymous
+// visitors, who are rate limited more strictly.
+func (app *application) getPublicTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	fq, err := app.readPageQuery(w, r, "desc")
+
+	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	feed, err := app.store.Posts.GetUserFeed(r.Context(), int64(42), fq)
+	user := getUserFromContext(r)
+
+	posts, page, err := app.store.Posts.GetPublicTimeline(r.Context(), user.ID, fq)
 
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := app.paginatedResponse(w, r, http.StatusOK, posts, page); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -9,8 +9,12 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/rpstvs/social/internal/db"
 	"github.com/rpstvs/social/internal/env"
+	"github.com/rpstvs/social/internal/ratelimiter"
+	"github.com/rpstvs/social/internal/search"
 	"github.com/rpstvs/social/internal/store"
 	"github.com/rpstvs/social/internal/store/cache"
+	"github.com/rpstvs/social/internal/timeline"
+	"github.com/rpstvs/social/internal/trending"
 	"go.uber.org/zap"
 )
 
@@ -25,6 +29,40 @@ const DEFAULT_PASSWORD = "oliveira"
 const DEFAULT_REDIS_ADDR = "localhost"
 const DEFAULT_REDIS_PW = "admin"
 const DEFAULT_EXP_TOKEN = 3 * time.Hour
+const DEFAULT_CACHE_BACKEND = "redis"
+const DEFAULT_CACHE_LOCAL_SIZE = 10_000
+const DEFAULT_CACHE_LOCAL_TTL = 15 * time.Second
+const DEFAULT_CACHE_MEMORY_SIZE = 10_000
+const DEFAULT_SCHEDULER_INTERVAL = 30 * time.Second
+const DEFAULT_SCHEDULER_BATCH_SIZE = 100
+const DEFAULT_TRASH_RETENTION = 30 * 24 * time.Hour
+const DEFAULT_TRASH_PURGE_INTERVAL = time.Hour
+const DEFAULT_TRASH_PURGE_BATCH_SIZE = 500
+const DEFAULT_API_URL = "http://localhost:8080"
+const DEFAULT_MEDIA_BACKEND = "local"
+const DEFAULT_MEDIA_ROOT = "./uploads"
+const DEFAULT_MEDIA_MAX_IMAGE_SIZE = 10 << 20
+const DEFAULT_MEDIA_MAX_VIDEO_SIZE = 100 << 20
+const DEFAULT_MEDIA_ORPHAN_TTL = 24 * time.Hour
+const DEFAULT_MEDIA_CLEANUP_INTERVAL = time.Hour
+const DEFAULT_MEDIA_WORKERS = 2
+const DEFAULT_MEDIA_PROCESSING_INTERVAL = 2 * time.Second
+const DEFAULT_MEDIA_PROCESSING_LEASE = 5 * time.Minute
+const DEFAULT_MEDIA_MAX_PIXELS = 40_000_000
+const DEFAULT_TRENDING_INTERVAL = 5 * time.Minute
+const DEFAULT_TIMELINE_WORKERS = 4
+const DEFAULT_TIMELINE_QUEUE_SIZE = 1000
+const DEFAULT_TIMELINE_CAPACITY = 800
+const DEFAULT_TIMELINE_CELEBRITY_THRESHOLD = 10_000
+const DEFAULT_TIMELINE_TTL = 7 * 24 * time.Hour
+const DEFAULT_SEARCH_SYNC_INTERVAL = 2 * time.Second
+const DEFAULT_SEARCH_SYNC_BATCH_SIZE = 200
+const DEFAULT_SEARCH_SYNC_LEASE = time.Minute
+const DEFAULT_RATELIMITER_REQUESTS = 100
+const DEFAULT_RATELIMITER_ANONYMOUS_REQUESTS = 20
+const DEFAULT_RATELIMITER_TIMEFRAME = time.Minute
+const DEFAULT_RATELIMITER_BACKEND = "redis"
+const DEFAULT_RATELIMITER_ALGORITHM = "sliding-window"
 
 func main() {
 
@@ -46,6 +84,72 @@ func main() {
 		DEFAULT_EXP_MAIL_INVITATION,
 		true)
 
+	config.cache = NewCacheConfig(
+		env.GetBool("CACHE_ENABLED", true),
+		env.GetString("CACHE_BACKEND", DEFAULT_CACHE_BACKEND),
+		env.GetInt("CACHE_LOCAL_SIZE", DEFAULT_CACHE_LOCAL_SIZE),
+		DEFAULT_CACHE_LOCAL_TTL,
+		env.GetInt("CACHE_MEMORY_SIZE", DEFAULT_CACHE_MEMORY_SIZE))
+
+	config.scheduler = NewSchedulerConfig(
+		env.GetBool("SCHEDULER_ENABLED", true),
+		DEFAULT_SCHEDULER_INTERVAL,
+		env.GetInt("SCHEDULER_BATCH_SIZE", DEFAULT_SCHEDULER_BATCH_SIZE))
+
+	config.requireIfMatch = env.GetBool("REQUIRE_IF_MATCH", false)
+	config.apiURL = env.GetString("EXTERNAL_URL", DEFAULT_API_URL)
+
+	config.media = NewMediaConfig(
+		env.GetString("MEDIA_BACKEND", DEFAULT_MEDIA_BACKEND),
+		env.GetString("MEDIA_ROOT", DEFAULT_MEDIA_ROOT),
+		NewS3Config(
+			env.GetString("S3_ENDPOINT", ""),
+			env.GetString("S3_BUCKET", ""),
+			env.GetString("S3_REGION", "us-east-1"),
+			env.GetString("S3_ACCESS_KEY", ""),
+			env.GetString("S3_SECRET_KEY", "")),
+		NewImageProcessingConfig(
+			env.GetInt("MEDIA_WORKERS", DEFAULT_MEDIA_WORKERS),
+			DEFAULT_MEDIA_PROCESSING_INTERVAL,
+			DEFAULT_MEDIA_PROCESSING_LEASE,
+			env.GetInt("MEDIA_MAX_PIXELS", DEFAULT_MEDIA_MAX_PIXELS)),
+		int64(env.GetInt("MEDIA_MAX_IMAGE_SIZE", DEFAULT_MEDIA_MAX_IMAGE_SIZE)),
+		int64(env.GetInt("MEDIA_MAX_VIDEO_SIZE", DEFAULT_MEDIA_MAX_VIDEO_SIZE)),
+		DEFAULT_MEDIA_ORPHAN_TTL,
+		DEFAULT_MEDIA_CLEANUP_INTERVAL)
+
+	config.rateLimiter = ratelimiter.Config{
+		RequestsPerTimeFrame:          env.GetInt("RATELIMITER_REQUESTS", DEFAULT_RATELIMITER_REQUESTS),
+		AnonymousRequestsPerTimeFrame: env.GetInt("RATELIMITER_ANONYMOUS_REQUESTS", DEFAULT_RATELIMITER_ANONYMOUS_REQUESTS),
+		TimeFrame:                     DEFAULT_RATELIMITER_TIMEFRAME,
+		Enabled:                       env.GetBool("RATELIMITER_ENABLED", true),
+		Algorithm:                     env.GetString("RATELIMITER_ALGORITHM", DEFAULT_RATELIMITER_ALGORITHM),
+		Backend:                       env.GetString("RATELIMITER_BACKEND", DEFAULT_RATELIMITER_BACKEND),
+	}
+
+	config.trending = NewTrendingConfig(
+		env.GetBool("TRENDING_ENABLED", true),
+		DEFAULT_TRENDING_INTERVAL)
+
+	config.timeline = NewTimelineConfig(
+		env.GetInt("TIMELINE_WORKERS", DEFAULT_TIMELINE_WORKERS),
+		env.GetInt("TIMELINE_QUEUE_SIZE", DEFAULT_TIMELINE_QUEUE_SIZE),
+		env.GetInt("TIMELINE_CAPACITY", DEFAULT_TIMELINE_CAPACITY),
+		env.GetInt("TIMELINE_CELEBRITY_THRESHOLD", DEFAULT_TIMELINE_CELEBRITY_THRESHOLD),
+		DEFAULT_TIMELINE_TTL)
+
+	config.search = NewSearchConfig(
+		env.GetBool("SEARCH_SYNC_ENABLED", true),
+		DEFAULT_SEARCH_SYNC_INTERVAL,
+		env.GetInt("SEARCH_SYNC_BATCH_SIZE", DEFAULT_SEARCH_SYNC_BATCH_SIZE),
+		DEFAULT_SEARCH_SYNC_LEASE)
+
+	config.trash = NewTrashConfig(
+		DEFAULT_TRASH_RETENTION,
+		env.GetBool("TRASH_PURGE_ENABLED", true),
+		DEFAULT_TRASH_PURGE_INTERVAL,
+		env.GetInt("TRASH_PURGE_BATCH_SIZE", DEFAULT_TRASH_PURGE_BATCH_SIZE))
+
 	db, err := db.New(config.db.addrDB, config.db.maxOpenConn, config.db.maxIdleConn, config.db.maxIdleTime)
 
 	logger := zap.Must(zap.NewProduction()).Sugar()
@@ -66,10 +170,55 @@ func main() {
 	}
 
 	store := store.NewStorage(db)
-	cacheStore := cache.NewRedisStorage(rdb)
+	cacheStore, err := newCacheStorage(config.cache, rdb)
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	config.trustedProxies, err = parseTrustedProxies(env.GetString("TRUSTED_PROXIES", ""))
+
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	app := NewApplication(config, store, cacheStore, logger)
 
+	app.rateLimiter, err = newLocalLimiter(config.rateLimiter.Algorithm, config.rateLimiter.RequestsPerTimeFrame, config.rateLimiter.TimeFrame)
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	app.anonRateLimiter, err = newLocalLimiter(config.rateLimiter.Algorithm, config.rateLimiter.AnonymousRequestsPerTimeFrame, config.rateLimiter.TimeFrame)
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// the local limiters stay as the fallback while redis is unreachable
+	if rdb != nil && config.rateLimiter.Backend == "redis" {
+		app.rateLimiter = ratelimiter.NewRedisLimiter(rdb, "requests", config.rateLimiter.RequestsPerTimeFrame, config.rateLimiter.TimeFrame, app.rateLimiter)
+		app.anonRateLimiter = ratelimiter.NewRedisLimiter(rdb, "anonymous", config.rateLimiter.AnonymousRequestsPerTimeFrame, config.rateLimiter.TimeFrame, app.anonRateLimiter)
+	}
+
+	app.searchIndex = search.NewPostgresIndex(db)
+
+	app.blobStore, err = newBlobStore(config.media)
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	// without redis every instance keeps its own copy of the rankings
+	if rdb != nil {
+		app.trending = trending.NewRedisStore(rdb)
+		app.timelines = timeline.NewStore(rdb, config.timeline.capacity, config.timeline.ttl)
+		app.timelineJobs = make(chan timelineJob, config.timeline.queueSize)
+	} else {
+		app.trending = trending.NewMemoryStore()
+	}
+
 	expvar.NewString("version").Set("0.0.0.1")
 	expvar.Publish("database", expvar.Func(func() any {
 		return db.Stats()
@@ -77,6 +226,7 @@ func main() {
 	expvar.Publish("goroutines", expvar.Func(func() any {
 		return runtime.NumGoroutine()
 	}))
+	expvar.Publish("cache", cache.Metrics())
 
 	mux := app.mount()
 
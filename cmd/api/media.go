@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rpstvs/social/internal/blobstore"
+	"github.com/rpstvs/social/internal/store"
+)
+
+const (
+	mediaKindImage = "image"
+	mediaKindVideo = "video"
+)
+
+type mediaType struct {
+	kind string
+	ext  string
+}
+
+// allowedMediaTypes is keyed by the content type sniffed from the upload,
+// never by the one the client claims.
+var allowedMediaTypes = map[string]mediaType{
+	"image/jpeg": {kind: mediaKindImage, ext: ".jpg"},
+	"image/png":  {kind: mediaKindImage, ext: ".png"},
+	"image/gif":  {kind: mediaKindImage, ext: ".gif"},
+	"video/mp4":  {kind: mediaKindVideo, ext: ".mp4"},
+	"video/webm": {kind: mediaKindVideo, ext: ".webm"},
+}
+
+// legacyMediaTypes were accepted before uploads were processed, but cannot be
+// decoded by the pipeline. New uploads are refused, and the existing ones are
+// kept and served as uploaded.
+var legacyMediaTypes = map[string]mediaType{
+	"image/webp": {kind: mediaKindImage, ext: ".webp"},
+}
+
+type AttachmentPayload struct {
+	ID      int64  `json:"id" validate:"required"`
+	AltText string `json:"alt_text" validate:"max=1000"`
+}
+
+// uploadMediaHandler accepts a multipart upload with a "file" field and an
+// optional "alt_text" field. The attachment stays unattached until a post
+// references it. Images are returned pending and only become visible once the
+// processing pipeline generated their variants.
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	// leave room for the multipart framing around the largest allowed file
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.media.maxVideoSize+1<<20)
+
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			app.payloadTooLargeResponse(w, r, err)
+			return
+		}
+
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(head[:n])
+	mt, ok := allowedMediaTypes[contentType]
+
+	if !ok {
+		app.unsupportedMediaTypeResponse(w, r, fmt.Errorf("unsupported media type %s", contentType))
+		return
+	}
+
+	limit := app.config.media.maxImageSize
+
+	if mt.kind == mediaKindVideo {
+		limit = app.config.media.maxVideoSize
+	}
+
+	if header.Size > limit {
+		app.payloadTooLargeResponse(w, r, fmt.Errorf("%s exceeds %d bytes", mt.kind, limit))
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	altText := r.FormValue("alt_text")
+
+	if len(altText) > 1000 {
+		app.badRequestResponse(w, r, fmt.Errorf("alt_text is too long"))
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	key := fmt.Sprintf("attachments/%d/%s%s", user.ID, uuid.New(), mt.ext)
+
+	if err := app.blobStore.Put(ctx, key, file, header.Size, contentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	attachment := &store.Attachment{
+		UserID:      user.ID,
+		Key:         key,
+		ContentType: contentType,
+		Size:        header.Size,
+		AltText:     altText,
+		Status:      store.AttachmentReady,
+	}
+
+	if mt.kind == mediaKindImage {
+		attachment.Status = store.AttachmentPending
+	} else {
+		attachment.URL = app.mediaURL(key)
+	}
+
+	if err := app.store.Attachments.Create(ctx, attachment); err != nil {
+		if err := app.blobStore.Delete(ctx, key); err != nil {
+			app.logger.Warnw("couldnt delete blob", "key", key, "error", err)
+		}
+
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, attachment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// serveMediaHandler serves image variants and uploaded videos to the viewers
+// who can read the post they belong to. Processed original images are never
+// served: they may still carry EXIF metadata.
+func (app *application) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+
+	if !servableMediaKey(key) {
+		app.notFoundResponse(w, r, blobstore.ErrNotFound)
+		return
+	}
+
+	access, err := app.store.Attachments.GetMediaAccess(r.Context(), key, getUserFromContext(r).ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// hidden media are reported missing, like the posts they belong to
+	if !access.Visible {
+		app.notFoundResponse(w, r, store.ErrNotFound)
+		return
+	}
+
+	blob, err := app.blobStore.Get(r.Context(), key)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrNotFound), errors.Is(err, blobstore.ErrInvalidKey):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	defer blob.Close()
+
+	if contentType, ok := mediaContentType(key); ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	// keys are never reused, but the post may be deleted or hidden later:
+	// shared caches keep public media for a short while only, and the rest
+	// stays with the viewer
+	if access.Public {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		w.Header().Add("Vary", "Authorization")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(w, blob); err != nil {
+		app.logger.Warnw("couldnt serve media", "key", key, "error", err)
+	}
+}
+
+// runMediaJanitor removes uploads that never made it into a post, or whose
+// post was purged, until ctx is cancelled.
+func (app *application) runMediaJanitor(ctx context.Context) {
+	ticker := time.NewTicker(app.config.media.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			orphans, err := app.store.Attachments.GetOrphans(ctx, app.config.media.orphanTTL, 100)
+
+			if err != nil {
+				app.logger.Errorw("couldnt list orphan attachments", "error", err)
+				continue
+			}
+
+			for _, orphan := range orphans {
+				keys := []string{orphan.Key}
+
+				for _, v := range orphan.Variants {
+					keys = append(keys, v.Key)
+				}
+
+				// the row goes first, and only if it is still unattached: an
+				// orphan attached since the scan keeps its blobs
+				if err := app.store.Attachments.Delete(ctx, orphan.ID); err != nil {
+					if !errors.Is(err, store.ErrNotFound) {
+						app.logger.Warnw("couldnt delete orphan attachment", "id", orphan.ID, "error", err)
+					}
+					continue
+				}
+
+				if err := app.deleteBlobs(ctx, keys); err != nil {
+					app.logger.Warnw("couldnt delete orphan blob", "id", orphan.ID, "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (app *application) mediaURL(key string) string {
+	return app.config.apiURL + "/v1/media/" + key
+}
+
+func servableMediaKey(key string) bool {
+	if strings.HasPrefix(key, "variants/") {
+		return true
+	}
+
+	for _, mt := range allowedMediaTypes {
+		if mt.kind == mediaKindVideo && mt.ext == path.Ext(key) {
+			return strings.HasPrefix(key, "attachments/")
+		}
+	}
+
+	for _, mt := range legacyMediaTypes {
+		if mt.ext == path.Ext(key) {
+			return strings.HasPrefix(key, "attachments/")
+		}
+	}
+
+	return false
+}
+
+// mediaContentType returns the content type of a blob from its extension.
+func mediaContentType(key string) (string, bool) {
+	for _, types := range []map[string]mediaType{allowedMediaTypes, legacyMediaTypes} {
+		for contentType, mt := range types {
+			if mt.ext == path.Ext(key) {
+				return contentType, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// deleteBlobs deletes every key, returning the first error once it tried
+// them all.
+func (app *application) deleteBlobs(ctx context.Context, keys []string) error {
+	var first error
+
+	for _, key := range keys {
+		if err := app.blobStore.Delete(ctx, key); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+func newBlobStore(cfg MediaConfig) (blobstore.Store, error) {
+	switch cfg.backend {
+	case "local":
+		return blobstore.NewLocalStore(cfg.localRoot)
+	case "s3":
+		return blobstore.NewS3Store(cfg.s3.endpoint, cfg.s3.bucket, cfg.s3.region, cfg.s3.accessKey, cfg.s3.secretKey)
+	default:
+		return nil, fmt.Errorf("unknown media backend %q", cfg.backend)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rpstvs/social/internal/imaging"
+	"github.com/rpstvs/social/internal/store"
+)
+
+// runMediaProcessor starts the configured number of workers turning pending
+// image uploads into variants, until ctx is cancelled.
+func (app *application) runMediaProcessor(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < app.config.media.processing.workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			app.mediaWorker(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (app *application) mediaWorker(ctx context.Context) {
+	ticker := time.NewTicker(app.config.media.processing.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// drain the queue before waiting for the next tick
+		for ctx.Err() == nil {
+			claimed, err := app.store.Attachments.ClaimPending(ctx, 1, app.config.media.processing.lease)
+
+			if err != nil {
+				app.logger.Errorw("couldnt claim pending attachments", "error", err)
+				break
+			}
+
+			if len(claimed) == 0 {
+				break
+			}
+
+			for i := range claimed {
+				app.processAttachment(ctx, &claimed[i])
+			}
+		}
+	}
+}
+
+// processAttachment settles a pending attachment. The cached owner is
+// invalidated once its state changed: it may be their avatar, cached with
+// its variants.
+func (app *application) processAttachment(ctx context.Context, attachment *store.Attachment) {
+	// legacy uploads the pipeline cannot decode stay as they were
+	if _, ok := legacyMediaTypes[attachment.ContentType]; ok {
+		if err := app.store.Attachments.KeepOriginal(ctx, attachment.ID, app.mediaURL(attachment.Key)); err != nil {
+			app.logger.Errorw("couldnt release attachment", "id", attachment.ID, "error", err)
+			return
+		}
+
+		app.invalidateUser(ctx, attachment.UserID)
+		return
+	}
+
+	err := app.generateVariants(ctx, attachment)
+
+	if err == nil {
+		app.invalidateUser(ctx, attachment.UserID)
+
+		// the original may hold EXIF/GPS metadata and is never served again
+		if err := app.blobStore.Delete(ctx, attachment.Key); err != nil {
+			app.logger.Warnw("couldnt delete original upload", "key", attachment.Key, "error", err)
+		}
+		return
+	}
+
+	// corrupt or oversized images will not get any better on retry
+	retry := !errors.Is(err, imaging.ErrUnsupported) && !errors.Is(err, imaging.ErrTooLarge)
+
+	app.logger.Warnw("couldnt process attachment", "id", attachment.ID, "retry", retry, "error", err)
+
+	if err := app.store.Attachments.FailProcessing(ctx, attachment.ID, retry); err != nil {
+		app.logger.Errorw("couldnt release attachment", "id", attachment.ID, "error", err)
+		return
+	}
+
+	// the last attempt fails the attachment even when retry is set
+	app.invalidateUser(ctx, attachment.UserID)
+}
+
+func (app *application) generateVariants(ctx context.Context, attachment *store.Attachment) error {
+	blob, err := app.blobStore.Get(ctx, attachment.Key)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(blob, app.config.media.maxImageSize+1))
+	blob.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if int64(len(data)) > app.config.media.maxImageSize {
+		return imaging.ErrTooLarge
+	}
+
+	result, err := imaging.Process(data, imaging.Options{
+		MaxPixels: app.config.media.processing.maxPixels,
+		Variants:  imaging.DefaultVariants,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	attachment.Width = &result.Width
+	attachment.Height = &result.Height
+	attachment.Blurhash = result.Blurhash
+	attachment.Variants = nil
+
+	prefix := fmt.Sprintf("variants/%d/%s", attachment.UserID, uuid.New())
+	var keys []string
+
+	for _, v := range result.Variants {
+		key := fmt.Sprintf("%s-%s%s", prefix, v.Name, allowedMediaTypes[v.ContentType].ext)
+
+		if err := app.blobStore.Put(ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+			app.deleteBlobs(ctx, keys)
+			return err
+		}
+
+		keys = append(keys, key)
+
+		attachment.Variants = append(attachment.Variants, store.AttachmentVariant{
+			Name:        v.Name,
+			Key:         key,
+			URL:         app.mediaURL(key),
+			ContentType: v.ContentType,
+			Width:       v.Width,
+			Height:      v.Height,
+			Size:        int64(len(v.Data)),
+		})
+	}
+
+	if err := app.store.Attachments.CompleteProcessing(ctx, attachment); err != nil {
+		app.deleteBlobs(ctx, keys)
+		return err
+	}
+
+	return nil
+}
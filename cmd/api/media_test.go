@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestServableMediaKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"image variant", "variants/42/0b9c/small.jpg", true},
+		{"image original", "attachments/42/0b9c.jpg", false},
+		{"video", "attachments/42/0b9c.mp4", true},
+		{"legacy image", "attachments/42/0b9c.webp", true},
+		{"video outside attachments", "uploads/42/0b9c.webm", false},
+		{"unknown extension", "attachments/42/0b9c.exe", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := servableMediaKey(tt.key); got != tt.want {
+				t.Errorf("servableMediaKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaContentType(t *testing.T) {
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"variants/42/0b9c/small.jpg", "image/jpeg", true},
+		{"attachments/42/0b9c.webm", "video/webm", true},
+		{"attachments/42/0b9c.webp", "image/webp", true},
+		{"attachments/42/0b9c", "", false},
+		{"attachments/42/0b9c.JPG", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := mediaContentType(tt.key)
+
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("mediaContentType(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/rpstvs/social/internal/ratelimiter"
 	"github.com/rpstvs/social/internal/store"
+	"github.com/rpstvs/social/internal/store/cache"
 )
 
-const userCtx = "user"
-
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -63,44 +67,68 @@ func (app *application) AuthTokenMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			parts := strings.Split(authHeader, " ")
-
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				app.UnauthorizedErrorResponse(w, r, fmt.Errorf("auth header malformed"))
-				return
-			}
-
-			jwtToken, err := app.authenticator.ValidateToken(parts[1])
+			user, err := app.authenticateToken(r.Context(), authHeader)
 
 			if err != nil {
 				app.UnauthorizedErrorResponse(w, r, err)
 				return
 			}
 
-			claims := jwtToken.Claims.(jwt.MapClaims)
-
-			userId, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+			ctx := context.WithValue(r.Context(), CTX_USER_KEY, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-			if err != nil {
-				app.UnauthorizedErrorResponse(w, r, err)
-				return
-			}
+// OptionalAuthTokenMiddleware lets anonymous visitors through read-only
+// routes. They get a zero user, whose ID matches nobody, so they only see
+// public posts. A token that is sent must still be valid.
+func (app *application) OptionalAuthTokenMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := &store.User{}
 
-			ctx := r.Context()
+			if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+				var err error
 
-			user, err := app.getUser(ctx, userId)
+				user, err = app.authenticateToken(r.Context(), authHeader)
 
-			if err != nil {
-				app.UnauthorizedErrorResponse(w, r, err)
-				return
+				if err != nil {
+					app.UnauthorizedErrorResponse(w, r, err)
+					return
+				}
 			}
 
-			ctx = context.WithValue(ctx, userCtx, user)
+			ctx := context.WithValue(r.Context(), CTX_USER_KEY, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+func (app *application) authenticateToken(ctx context.Context, authHeader string) (*store.User, error) {
+	parts := strings.Split(authHeader, " ")
+
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, fmt.Errorf("auth header malformed")
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(parts[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwtToken.Claims.(jwt.MapClaims)
+
+	userId, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return app.getUser(ctx, userId)
+}
+
 func (app *application) checkPostOwnership(requiredRole string, handler http.HandlerFunc) http.HandlerFunc {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -132,14 +160,146 @@ func (app *application) checkPostOwnership(requiredRole string, handler http.Han
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
-			if allow, retryAfter := app.rateLimiter.Allow(r.RemoteAddr); !allow {
+			if allow, retryAfter := app.rateLimiter.Allow(clientIP(r)); !allow {
 				app.rateLimitExceedResponse(w, r, retryAfter.String())
 				return
 			}
 		}
+
+		next.ServeHTTP(w, r)
 	})
 }
 
+func newLocalLimiter(algorithm string, limit int, window time.Duration) (ratelimiter.Limiter, error) {
+	switch algorithm {
+	case "fixed-window":
+		return ratelimiter.NewFixedWindowRateLimiter(limit, window), nil
+	case "sliding-window":
+		return ratelimiter.NewSlidingWindowRateLimiter(limit, window), nil
+	case "token-bucket":
+		return ratelimiter.NewTokenBucketRateLimiter(limit, window), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter algorithm %q", algorithm)
+	}
+}
+
+// AnonymousRateLimiterMiddleware applies the stricter anonymous limit to
+// visitors let through by OptionalAuthTokenMiddleware, on top of the global
+// one.
+func (app *application) AnonymousRateLimiterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.rateLimiter.Enabled && getUserFromContext(r).ID == 0 {
+			if allow, retryAfter := app.anonRateLimiter.Allow(clientIP(r)); !allow {
+				app.rateLimitExceedResponse(w, r, retryAfter.String())
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RealIPMiddleware replaces the remote address with the client address
+// forwarded by X-Forwarded-For or X-Real-IP, but only for requests coming
+// from one of the trusted proxies: anyone else could make up the headers to
+// pick the address they are rate limited under.
+func (app *application) RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := app.forwardedIP(r); ok {
+			r.RemoteAddr = ip
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP walks X-Forwarded-For from the closest hop back, skipping the
+// trusted proxies, and returns the first address not among them.
+func (app *application) forwardedIP(r *http.Request) (string, bool) {
+	peer, err := netip.ParseAddr(clientIP(r))
+
+	if err != nil || !app.trustedProxy(peer) {
+		return "", false
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+
+		if err != nil {
+			break
+		}
+
+		if !app.trustedProxy(addr) {
+			return addr.String(), true
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return addr.String(), true
+	}
+
+	return "", false
+}
+
+func (app *application) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range app.config.trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTrustedProxies reads a comma separated list of CIDRs, single
+// addresses standing for themselves.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// clientIP is the address set by RealIPMiddleware, without the port a
+// direct connection carries.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, requiredRole string) (bool, error) {
 	role, err := app.store.Roles.GetByName(ctx, requiredRole)
 
@@ -150,32 +310,100 @@ func (app *application) checkRolePrecedence(ctx context.Context, user *store.Use
 	return int(user.Role.ID) >= role.Level, nil
 }
 
+// getUser reads the user through the cache. Concurrent misses for a user
+// share a single database read, and stale users are served while they are
+// refreshed in the background.
 func (app *application) getUser(ctx context.Context, userId int64) (*store.User, error) {
 
-	if !app.config.redisCfg.enabled {
+	if !app.config.cache.enabled {
 		return app.store.Users.GetById(ctx, userId)
 	}
 
-	redisUser, err := app.cacheStorage.Users.Get(ctx, userId)
+	user, stale, err := app.cacheStorage.Users.Get(ctx, userId)
 
 	if err != nil {
-		return nil, err
+		app.logger.Warnw("couldnt read user from cache", "user", userId, "error", err)
 	}
 
-	if redisUser == nil {
-		dbUser, err := app.store.Users.GetById(ctx, userId)
+	if user == nil {
+		return app.loadUser(ctx, userId)
+	}
 
-		if err != nil {
-			return nil, err
+	if stale {
+		go app.loadUser(context.Background(), userId)
+	}
+
+	return user, nil
+}
+
+// loadUser reads the user from the database into the cache, once for all
+// the concurrent callers. The read is not cancelled with the caller that
+// started it, as the others are waiting on it too. The user is not cached
+// when invalidated while being read.
+func (app *application) loadUser(ctx context.Context, userId int64) (*store.User, error) {
+	v, err, _ := app.userLoads.Do(strconv.FormatInt(userId, 10), func() (any, error) {
+		ctx := context.WithoutCancel(ctx)
+
+		generation, genErr := app.cacheStorage.Users.Generation(ctx, userId)
+
+		if genErr != nil {
+			app.logger.Warnw("couldnt read user generation from cache", "user", userId, "error", genErr)
 		}
 
-		err = app.cacheStorage.Users.Set(ctx, dbUser)
+		user, err := app.store.Users.GetById(ctx, userId)
 
 		if err != nil {
-			app.logger.Warn("couldnt add user to cache")
+			return nil, err
 		}
-		return dbUser, nil
+
+		if genErr == nil {
+			if err := app.cacheStorage.Users.Set(ctx, user, generation); err != nil && !errors.Is(err, cache.ErrStale) {
+				app.logger.Warn("couldnt add user to cache")
+			}
+		}
+
+		return user, nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return redisUser, nil
+	user := *v.(*store.User)
+
+	return &user, nil
+}
+
+// invalidateUser drops the cached user after a change, on every instance.
+func (app *application) invalidateUser(ctx context.Context, userId int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Users.Delete(ctx, userId); err != nil {
+		app.logger.Errorw("couldnt invalidate cached user", "user", userId, "error", err)
+	}
+}
+
+// runCacheListener applies the invalidations of other instances to the
+// users kept in process until ctx is cancelled, resubscribing when the
+// subscription fails.
+func (app *application) runCacheListener(ctx context.Context) {
+	listener, ok := app.cacheStorage.Users.(cache.Listener)
+
+	if !app.config.cache.enabled || !ok {
+		return
+	}
+
+	for {
+		if err := listener.Listen(ctx); err != nil {
+			app.logger.Errorw("couldnt listen for cache invalidations", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"10.0.0.1", []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}, false},
+		{
+			" 10.0.0.0/8, ::ffff:192.168.1.1 ,",
+			[]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.1/32")},
+			false,
+		},
+		{"10.1.2.3/8", []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}, false},
+		{"fd00::/8", []netip.Prefix{netip.MustParsePrefix("fd00::/8")}, false},
+		{"10.0.0.1, proxy.internal", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := parseTrustedProxies(tt.list)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTrustedProxies(%q) = %v, want an error", tt.list, got)
+				}
+
+				return
+			}
+
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("parseTrustedProxies(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIPMiddleware(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, fd00::1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewTestApplication(t, config{trustedProxies: proxies})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		wantRemoteIP string
+	}{
+		{"direct client", "203.0.113.7:4321", "", "", "203.0.113.7"},
+		{"untrusted peer making up headers", "203.0.113.7:4321", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"behind a trusted proxy", "10.0.0.2:4321", "198.51.100.1", "", "198.51.100.1"},
+		{"client spoofing earlier hops", "10.0.0.2:4321", "1.2.3.4, 198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:4321", "198.51.100.1, 10.0.0.3", "", "198.51.100.1"},
+		{"IPv6 proxy", "[fd00::1]:4321", "2001:db8::7", "", "2001:db8::7"},
+		{"mapped IPv4 proxy", "[::ffff:10.0.0.2]:4321", "198.51.100.1", "", "198.51.100.1"},
+		{"X-Real-IP", "10.0.0.2:4321", "", "198.51.100.2", "198.51.100.2"},
+		{"malformed hop falls back to X-Real-IP", "10.0.0.2:4321", "unknown", "198.51.100.2", "198.51.100.2"},
+		{"only trusted hops", "10.0.0.2:4321", "10.0.0.3", "", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+
+			app.RealIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.wantRemoteIP {
+				t.Errorf("client IP = %q, want %q", got, tt.wantRemoteIP)
+			}
+		})
+	}
+}
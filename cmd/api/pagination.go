@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/rpstvs/social/internal/cursor"
+	"github.com/rpstvs/social/internal/store"
+)
+
+// readPageQuery parses the paging parameters of a list request. A "cursor"
+// parameter takes over from "offset", which is still honoured but flagged
+// as deprecated, and is rejected when it was issued for another list. sort is
+// the order used when the request does not pick one.
+func (app *application) readPageQuery(w http.ResponseWriter, r *http.Request, sort string) (store.PaginatedFeedQuery, error) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   sort,
+	}
+
+	fq, err := fq.Parse(r)
+
+	if err != nil {
+		return fq, err
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		return fq, err
+	}
+
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		c, err := app.cursors.Decode(token)
+
+		if err != nil {
+			return fq, err
+		}
+
+		if c.Scope != pageScope(r) {
+			return fq, fmt.Errorf("%w: it belongs to another list", cursor.ErrInvalid)
+		}
+
+		fq.Cursor = &c
+		fq.Offset = 0
+	} else if r.URL.Query().Has("offset") {
+		w.Header().Set("Deprecation", "true")
+	}
+
+	return fq, nil
+}
+
+// paginatedResponse writes a page of a list along with the cursors to its
+// neighbours, both in the body and as RFC 8288 Link headers.
+func (app *application) paginatedResponse(w http.ResponseWriter, r *http.Request, status int, data any, page store.Page) error {
+	type envelope struct {
+		Data       any    `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+	}
+
+	env := envelope{Data: data}
+	scope := pageScope(r)
+
+	if page.Next != nil {
+		next := *page.Next
+		next.Scope = scope
+		env.NextCursor = app.cursors.Encode(next)
+		w.Header().Add("Link", app.pageLink(r, env.NextCursor, "next"))
+	}
+
+	if page.Prev != nil {
+		prev := *page.Prev
+		prev.Scope = scope
+		env.PrevCursor = app.cursors.Encode(prev)
+		w.Header().Add("Link", app.pageLink(r, env.PrevCursor, "prev"))
+	}
+
+	return RespondWithJson(status, w, &env)
+}
+
+// pageScope identifies the list a request pages through: its path, which
+// holds the post or user the list belongs to, and the parameters choosing
+// and ordering its items. The paging parameters themselves are left out.
+func pageScope(r *http.Request) string {
+	qs := r.URL.Query()
+	qs.Del("cursor")
+	qs.Del("offset")
+	qs.Del("limit")
+
+	sum := sha256.Sum256([]byte(r.URL.Path + "?" + qs.Encode()))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (app *application) pageLink(r *http.Request, token, rel string) string {
+	u := *r.URL
+
+	qs := u.Query()
+	qs.Del("offset")
+	qs.Set("cursor", token)
+	u.RawQuery = qs.Encode()
+
+	return fmt.Sprintf(`<%s%s>; rel="%s"`, app.config.apiURL, u.RequestURI(), rel)
+}
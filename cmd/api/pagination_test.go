@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rpstvs/social/internal/cursor"
+)
+
+func TestReadPageQuery(t *testing.T) {
+	app := NewTestApplication(t, config{})
+	app.cursors = cursor.NewSigner("secret")
+
+	// cursorFor signs a cursor the way paginatedResponse does for target
+	cursorFor := func(target string) string {
+		scope := pageScope(httptest.NewRequest(http.MethodGet, target, nil))
+
+		return app.cursors.Encode(cursor.Cursor{At: "2026-10-19T12:00:00Z", ID: 42, Scope: scope})
+	}
+
+	forged := cursor.NewSigner("other secret").Encode(cursor.Cursor{
+		At:    "2026-10-19T12:00:00Z",
+		ID:    42,
+		Scope: pageScope(httptest.NewRequest(http.MethodGet, "/v1/posts/1/comments", nil)),
+	})
+
+	tests := []struct {
+		name    string
+		target  string
+		token   string
+		wantErr bool
+	}{
+		{"issued for the list", "/v1/posts/1/comments", cursorFor("/v1/posts/1/comments"), false},
+		{"paging parameters changed", "/v1/posts/1/comments?limit=5", cursorFor("/v1/posts/1/comments?offset=20&limit=10"), false},
+		{"same parameters, another order", "/v1/users/feed?tags=go&sort=asc", cursorFor("/v1/users/feed?sort=asc&tags=go"), false},
+		{"another post", "/v1/posts/2/comments", cursorFor("/v1/posts/1/comments"), true},
+		{"another sort", "/v1/users/feed?sort=asc", cursorFor("/v1/users/feed?sort=desc"), true},
+		{"another filter", "/v1/users/feed?tags=rust", cursorFor("/v1/users/feed?tags=go"), true},
+		{"forged", "/v1/posts/1/comments", forged, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			q := r.URL.Query()
+			q.Set("cursor", tt.token)
+			r.URL.RawQuery = q.Encode()
+
+			fq, err := app.readPageQuery(httptest.NewRecorder(), r, "desc")
+
+			if tt.wantErr {
+				if !errors.Is(err, cursor.ErrInvalid) {
+					t.Fatalf("readPageQuery() err = %v, want ErrInvalid", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fq.Cursor == nil || fq.Cursor.ID != 42 || fq.Offset != 0 {
+				t.Errorf("readPageQuery() = %+v, want the cursor in place of the offset", fq)
+			}
+		})
+	}
+}
+
+func TestReadPageQueryOffsetDeprecated(t *testing.T) {
+	app := NewTestApplication(t, config{})
+	app.cursors = cursor.NewSigner("secret")
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/v1/posts/1/comments", ""},
+		{"/v1/posts/1/comments?offset=0", "true"},
+		{"/v1/posts/1/comments?offset=20&limit=10", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			fq, err := app.readPageQuery(w, httptest.NewRequest(http.MethodGet, tt.target, nil), "desc")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fq.Cursor != nil {
+				t.Errorf("Cursor = %+v, want none", fq.Cursor)
+			}
+
+			if got := w.Header().Get("Deprecation"); got != tt.want {
+				t.Errorf("Deprecation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageScope(t *testing.T) {
+	scope := func(target string) string {
+		return pageScope(httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"paging parameters left out", "/v1/search?q=go", "/v1/search?q=go&limit=5&offset=10&cursor=abc", true},
+		{"parameter order left out", "/v1/search?q=go&type=posts", "/v1/search?type=posts&q=go", true},
+		{"another query", "/v1/search?q=go", "/v1/search?q=rust", false},
+		{"another kind of result", "/v1/search?q=go&type=posts", "/v1/search?q=go&type=users", false},
+		{"another list", "/v1/posts/1/comments", "/v1/posts/2/comments", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scope(tt.a) == scope(tt.b); got != tt.same {
+				t.Errorf("same scope for %s and %s = %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+		})
+	}
+}
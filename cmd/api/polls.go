@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+const (
+	minPollDuration = 5 * time.Minute
+	maxPollDuration = 30 * 24 * time.Hour
+)
+
+type PollPayload struct {
+	Options  []string `json:"options" validate:"min=2,max=6,dive,required,max=100"`
+	Multiple bool     `json:"multiple"`
+	// PublicResults shows the counts to everyone instead of only to voters
+	// and, once the poll expired, to everyone.
+	PublicResults bool      `json:"public_results"`
+	ExpiresAt     time.Time `json:"expires_at" validate:"required"`
+}
+
+type VotePayload struct {
+	OptionIDs []int64 `json:"option_ids" validate:"min=1,max=6"`
+}
+
+// newPoll checks the poll runs for a sensible time after the post is
+// published, which is now unless it is scheduled.
+func newPoll(payload *PollPayload, publishAt *time.Time) (*store.Poll, error) {
+	start := time.Now()
+
+	if publishAt != nil {
+		start = *publishAt
+	}
+
+	duration := payload.ExpiresAt.Sub(start)
+
+	if duration < minPollDuration || duration > maxPollDuration {
+		return nil, fmt.Errorf("poll must expire between %s and %s after the post is published", minPollDuration, maxPollDuration)
+	}
+
+	poll := &store.Poll{
+		Multiple:      payload.Multiple,
+		PublicResults: payload.PublicResults,
+		ExpiresAt:     payload.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+
+	for _, text := range payload.Options {
+		poll.Options = append(poll.Options, store.PollOption{Text: text})
+	}
+
+	return poll, nil
+}
+
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VotePayload
+
+	if err := ReadJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	post := getPostfromCtx(r)
+
+	if post.Status != store.StatusPublished {
+		app.forbiddenResponse(w, r, fmt.Errorf("post is not published"))
+		return
+	}
+
+	if err := app.store.Polls.Vote(r.Context(), post.ID, user.ID, payload.OptionIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, fmt.Errorf("already voted"))
+		case errors.Is(err, store.ErrPollClosed), errors.Is(err, store.ErrInvalidChoices):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	updated, err := app.store.Posts.GetVisibleById(r.Context(), post.ID, user.ID)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, updated.Poll); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
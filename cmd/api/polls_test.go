@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewPoll(t *testing.T) {
+	publishAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	tests := []struct {
+		name      string
+		publishAt *time.Time
+		// expiry, from the publication or from now when publishAt is nil
+		expiresIn time.Duration
+		wantErr   bool
+	}{
+		{"published now", nil, time.Hour, false},
+		{"published now, too short", nil, time.Minute, true},
+		{"published now, too long", nil, maxPollDuration + time.Hour, true},
+		{"scheduled, shortest", &publishAt, minPollDuration, false},
+		{"scheduled, longest", &publishAt, maxPollDuration, false},
+		{"scheduled, too short", &publishAt, minPollDuration - 1, true},
+		{"scheduled, too long", &publishAt, maxPollDuration + 1, true},
+		// long from now, but short from the publication
+		{"scheduled, expires before publication", &publishAt, -time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+
+			if tt.publishAt != nil {
+				start = *tt.publishAt
+			}
+
+			payload := &PollPayload{
+				Options:   []string{"yes", "no"},
+				Multiple:  true,
+				ExpiresAt: start.Add(tt.expiresIn),
+			}
+
+			poll, err := newPoll(payload, tt.publishAt)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("newPoll() accepted the expiry")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := payload.ExpiresAt.UTC().Format(time.RFC3339); poll.ExpiresAt != want {
+				t.Errorf("ExpiresAt = %q, want %q", poll.ExpiresAt, want)
+			}
+
+			if !poll.Multiple || len(poll.Options) != 2 || poll.Options[1].Text != "no" {
+				t.Errorf("poll = %+v, want the payload's options", poll)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+// cacheablePost reports whether the post reads the same for every viewer,
+// and so can be cached: a public published original, without a poll, whose
+// media is ready.
+func cacheablePost(post *store.Post) bool {
+	if post.Visibility != store.VisibilityPublic || post.Status != store.StatusPublished {
+		return false
+	}
+
+	if post.RepostOfID != nil || post.Poll != nil || post.DeletedAt != nil {
+		return false
+	}
+
+	for _, a := range post.Attachments {
+		if a.Status != store.AttachmentReady {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getPost returns the post when the viewer can read it, going through the
+// cache when redis is enabled. Posts hidden from the viewer are reported as
+// store.ErrNotFound, but only posts that do not exist are cached as such.
+// Cached posts are only served while their author is active.
+func (app *application) getPost(ctx context.Context, id, viewerID int64) (*store.Post, error) {
+	if !app.config.cache.enabled {
+		return app.store.Posts.GetVisibleById(ctx, id, viewerID)
+	}
+
+	cached, err := app.cacheStorage.Posts.Get(ctx, id)
+
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return nil, err
+	case err != nil:
+		app.logger.Warnw("couldnt read post from cache", "post", id, "error", err)
+	case cached != nil:
+		active, err := app.activeAuthor(ctx, cached.UserID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !active {
+			return nil, store.ErrNotFound
+		}
+
+		return cached, nil
+	}
+
+	// read before the post, so that a write invalidating it meanwhile keeps
+	// this read out of the cache
+	generation, genErr := app.cacheStorage.Posts.Generation(ctx, id)
+
+	if genErr != nil {
+		app.logger.Warnw("couldnt read post generation from cache", "post", id, "error", genErr)
+	}
+
+	post, err := app.store.Posts.GetVisibleById(ctx, id, viewerID)
+
+	if errors.Is(err, store.ErrNotFound) {
+		if _, err := app.store.Posts.GetById(ctx, id); errors.Is(err, store.ErrNotFound) {
+			app.forgetCachedPost(ctx, id)
+		}
+		return nil, store.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if genErr == nil && cacheablePost(post) {
+		if err := app.cacheStorage.Posts.Set(ctx, post, generation); err != nil {
+			app.logger.Warnw("couldnt add post to cache", "post", id, "error", err)
+		}
+	}
+
+	return post, nil
+}
+
+// getPostsByIds is GetHydratedByIds served from the cache where possible.
+// Only single post reads fill the cache. Cached posts whose author is no
+// longer active are skipped, as GetHydratedByIds does.
+func (app *application) getPostsByIds(ctx context.Context, ids []int64, viewerID int64) ([]store.Post, error) {
+	if !app.config.cache.enabled {
+		return app.store.Posts.GetHydratedByIds(ctx, ids, viewerID)
+	}
+
+	cached, err := app.cacheStorage.Posts.MGet(ctx, ids)
+
+	if err != nil {
+		app.logger.Warnw("couldnt read posts from cache", "error", err)
+		cached = nil
+	}
+
+	var posts []store.Post
+	var missing []int64
+
+	authors := make(map[int64]bool)
+
+	for _, id := range ids {
+		p, ok := cached[id]
+
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+
+		active, checked := authors[p.UserID]
+
+		if !checked {
+			if active, err = app.activeAuthor(ctx, p.UserID); err != nil {
+				return nil, err
+			}
+
+			authors[p.UserID] = active
+		}
+
+		if active {
+			posts = append(posts, *p)
+		}
+	}
+
+	if len(missing) == 0 {
+		return posts, nil
+	}
+
+	loaded, err := app.store.Posts.GetHydratedByIds(ctx, missing, viewerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(posts, loaded...), nil
+}
+
+// activeAuthor reports whether the author of a cached post is still active,
+// reading them through the user cache: only active users are found.
+func (app *application) activeAuthor(ctx context.Context, userID int64) (bool, error) {
+	_, err := app.getUser(ctx, userID)
+
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// invalidateCachedPost drops the cached post after a write that left it at
+// the given version. Updated posts are not written through: the post at
+// hand may have been read before another write, such as a repost, that
+// leaves the version alone.
+func (app *application) invalidateCachedPost(ctx context.Context, id int64, version string) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Posts.Delete(ctx, id, version); err != nil {
+		app.logger.Errorw("couldnt invalidate cached post", "post", id, "error", err)
+	}
+}
+
+// forgetCachedPost caches that the post does not exist, after it was deleted
+// or looked up in vain.
+func (app *application) forgetCachedPost(ctx context.Context, id int64) {
+	if !app.config.cache.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Posts.SetNotFound(ctx, id); err != nil {
+		app.logger.Errorw("couldnt cache missing post", "post", id, "error", err)
+	}
+}
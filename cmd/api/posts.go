@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rpstvs/social/internal/store"
@@ -15,9 +17,17 @@ type postKey string
 const postCtxValue postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validator:"required, max=100"`
-	Content string   `json:"content" validator:"required, max=1000"`
-	Tags    []string `json:"tags"`
+	Title      string   `json:"title" validator:"required, max=100"`
+	Content    string   `json:"content" validator:"required, max=1000"`
+	Tags       []string `json:"tags"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	Mentions   []int64  `json:"mentions" validate:"max=50"`
+	// Draft keeps the post private to its author until it is published.
+	// PublishAt schedules it instead and takes precedence over Draft.
+	Draft       bool                `json:"draft"`
+	PublishAt   *time.Time          `json:"publish_at"`
+	Attachments []AttachmentPayload `json:"attachments" validate:"max=4,dive"`
+	Poll        *PollPayload        `json:"poll"`
 }
 
 func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -35,18 +45,53 @@ func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request
 
 	user := getUserFromContext(r)
 
+	status, publishAt, err := postStatus(payload.Draft, payload.PublishAt)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	post := store.Post{
-		Title:   payload.Title,
-		Content: payload.Title,
-		UserID:  user.ID,
-		Tags:    payload.Tags,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		UserID:     user.ID,
+		Tags:       payload.Tags,
+		Visibility: payload.Visibility,
+		Mentions:   payload.Mentions,
+		Status:     status,
+		PublishAt:  publishAt,
+	}
+
+	for _, a := range payload.Attachments {
+		post.Attachments = append(post.Attachments, store.Attachment{ID: a.ID, AltText: a.AltText})
+	}
+
+	if payload.Poll != nil {
+		post.Poll, err = newPoll(payload.Poll, payload.PublishAt)
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
 	}
 
 	if err := app.store.Posts.Create(r.Context(), &post); err != nil {
-		RespondWithError(http.StatusBadRequest, w, err.Error())
+		switch {
+		case errors.Is(err, store.ErrAttachmentUnavailable):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
+	app.invalidateCachedPost(r.Context(), post.ID, post.Version)
+
+	if post.Status == store.StatusPublished {
+		app.pushToTimelines(post.ID)
+	}
+
 	if err := RespondWithJson(http.StatusCreated, w, post); err != nil {
 		RespondWithError(http.StatusBadRequest, w, err.Error())
 		return
@@ -56,22 +101,48 @@ func (app *application) CreatePostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) GetPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post := getPostfromCtx(r)
+	user := getUserFromContext(r)
 
-	comments, err := app.store.Comments.GetById(r.Context(), post.ID)
+	body, etag, err := app.postRepresentation(r.Context(), post, user.ID)
 
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	post.Comments = *comments
-	err = RespondWithJson(http.StatusOK, w, post)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if err := writeRepresentation(w, http.StatusOK, body, etag); err != nil {
+		app.logger.Errorw("couldnt write post", "post", post.ID, "error", err)
+	}
+}
+
+// getPostCommentsHandler pages through the comments of the post in the
+// context, oldest first unless sort=desc.
+func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostfromCtx(r)
+
+	fq, err := app.readPageQuery(w, r, "asc")
 
 	if err != nil {
-		RespondWithError(http.StatusInternalServerError, w, err.Error())
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comments, page, err := app.store.Comments.GetByPost(r.Context(), post.ID, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
 
+	if err := app.paginatedResponse(w, r, http.StatusOK, comments, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 func (app *application) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -82,22 +153,160 @@ func (app *application) DeletePostHandler(w http.ResponseWriter, r *http.Request
 		RespondWithError(http.StatusInternalServerError, w, err.Error())
 		return
 	}
-	err = app.store.Posts.DeletePost(r.Context(), id)
+	user := getUserFromContext(r)
+	post := getPostfromCtx(r)
+
+	// a conditional delete only applies to the version If-Match was checked
+	// against
+	var version string
+
+	if r.Header.Get("If-Match") != "" {
+		version = post.Version
+	}
+
+	err = app.store.Posts.DeletePost(r.Context(), id, user.ID, version)
 
 	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.forgetCachedPost(r.Context(), id)
+
+	if post.RepostOf != nil {
+		app.invalidateCachedPost(r.Context(), post.RepostOf.ID, post.RepostOf.Version)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type RepostPayload struct {
+	// Quote makes a quote post, carrying its own title and content, possibly
+	// empty; otherwise the repost is plain and takes neither.
+	Quote   bool   `json:"quote"`
+	Title   string `json:"title" validate:"max=100"`
+	Content string `json:"content" validate:"max=1000"`
+}
+
+// RepostHandler shares the post from the context, either as a plain repost
+// or as a quote post referencing the original.
+func (app *application) RepostHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RepostPayload
+
+	if r.ContentLength != 0 {
+		if err := ReadJson(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !payload.Quote && (payload.Title != "" || payload.Content != "") {
+		app.badRequestResponse(w, r, fmt.Errorf("plain reposts take no title or content, set quote to quote the post"))
+		return
+	}
+
+	user := getUserFromContext(r)
+	target := getPostfromCtx(r)
+
+	original := target
+
+	if target.IsRepost {
+		if target.RepostOf == nil {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+		original = target.RepostOf
+	}
+
+	if original.Visibility != store.VisibilityPublic || original.Status != store.StatusPublished {
+		app.forbiddenResponse(w, r, fmt.Errorf("only public posts can be reposted"))
+		return
+	}
+
+	post := store.Post{
+		Title:      payload.Title,
+		Content:    payload.Content,
+		UserID:     user.ID,
+		RepostOfID: &original.ID,
+		IsRepost:   !payload.Quote,
+	}
+
+	if err := app.store.Posts.Create(r.Context(), &post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateCachedPost(r.Context(), original.ID, original.Version)
+	app.pushToTimelines(post.ID)
+
+	post.RepostOf = original
+
+	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
+		return
 	}
+}
+
+// UnrepostHandler undoes the user's plain repost of the post from the
+// context, or of its original when it is itself a repost, as RepostHandler
+// resolves it.
+func (app *application) UnrepostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	post := getPostfromCtx(r)
+
+	if post.IsRepost {
+		if post.RepostOf == nil {
+			app.notFoundResponse(w, r, store.ErrNotFound)
+			return
+		}
+		post = post.RepostOf
+	}
+
+	if err := app.store.Posts.Unrepost(r.Context(), user.ID, post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateCachedPost(r.Context(), post.ID, post.Version)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty, max=100"`
-	Content *string `json:"content" validate:"omitempty, max=1000"`
+	Title      *string  `json:"title" validate:"omitempty, max=100"`
+	Content    *string  `json:"content" validate:"omitempty, max=1000"`
+	Visibility *string  `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	Mentions   *[]int64 `json:"mentions" validate:"omitempty,max=50"`
+	// Draft and PublishAt only apply to posts that are not published yet.
+	Draft     *bool      `json:"draft"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 func (app *application) UpdatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostfromCtx(r)
+	user := getUserFromContext(r)
 
 	var payload UpdatePostPayload
 
@@ -119,17 +328,83 @@ func (app *application) UpdatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+
+	if payload.Mentions != nil {
+		post.Mentions = *payload.Mentions
+	}
+
+	// a draft or scheduled post published by the update is fanned out
+	published := false
+
+	if payload.Draft != nil || payload.PublishAt != nil {
+		if post.Status == store.StatusPublished {
+			app.badRequestResponse(w, r, fmt.Errorf("post is already published"))
+			return
+		}
+
+		draft := payload.Draft == nil || *payload.Draft
+		status, publishAt, err := postStatus(draft, payload.PublishAt)
+
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		post.Status = status
+		post.PublishAt = publishAt
+		published = status == store.StatusPublished
+	}
+
+	post.EditorID = user.ID
+
 	err := app.store.Posts.Update(r.Context(), post)
 
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateCachedPost(r.Context(), post.ID, post.Version)
+
+	if published {
+		app.pushToTimelines(post.ID)
+	}
+
+	// reload the post as a read would see it, so that its tag is the one
+	// the next read gets
+	updated, err := app.store.Posts.GetVisibleById(r.Context(), post.ID, user.ID)
+
+	// a moderator may no longer see the post they edited
+	if errors.Is(err, store.ErrNotFound) {
+		if err := RespondWithJson(http.StatusCreated, w, post); err != nil {
+			app.logger.Errorw("couldnt write post", "post", post.ID, "error", err)
+		}
+		return
+	}
+
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := RespondWithJson(http.StatusCreated, w, post); err != nil {
-		RespondWithError(http.StatusBadRequest, w, err.Error())
+	body, etag, err := app.postRepresentation(r.Context(), updated, user.ID)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
+
+	if err := writeRepresentation(w, http.StatusCreated, body, etag); err != nil {
+		app.logger.Errorw("couldnt write post", "post", post.ID, "error", err)
+	}
 }
 
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
@@ -143,7 +418,8 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		ctx := r.Context()
-		post, err := app.store.Posts.GetById(r.Context(), id)
+		user := getUserFromContext(r)
+		post, err := app.getPost(ctx, id, user.ID)
 
 		if err != nil {
 
@@ -159,7 +435,7 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx = context.WithValue(ctx, postCtxValue, post)
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rpstvs/social/internal/cursor"
+	"github.com/rpstvs/social/internal/ranking"
+	"github.com/rpstvs/social/internal/store"
+)
+
+const (
+	// rankedFeedWindow is how far back the ranked feed looks for posts.
+	rankedFeedWindow = 72 * time.Hour
+	// rankedFeedCandidates bounds the posts scored for one request.
+	rankedFeedCandidates = 500
+)
+
+// rankedPost is an entry of the ranked feed. Explanation is only filled in
+// debug builds.
+type rankedPost struct {
+	store.PostWithMetaData
+	Explanation *ranking.Explanation `json:"explanation,omitempty"`
+	score       float64
+}
+
+// getRankedFeed serves the feed in ranked mode: the recent posts of
+// followed accounts, followed tags and second-degree network matching the
+// filters, best first. Rankings move with time, so the cursors pin the time
+// the first page was ranked at: the following pages rank the same
+// candidates, with the engagement they had then.
+func (app *application) getRankedFeed(w http.ResponseWriter, r *http.Request, user *store.User, fq store.PaginatedFeedQuery) {
+	if fq.Sort != "desc" {
+		app.badRequestResponse(w, r, errors.New("the ranked feed is sorted by score"))
+		return
+	}
+
+	if fq.Offset > 0 {
+		app.badRequestResponse(w, r, errors.New("the ranked feed is paged by cursor"))
+		return
+	}
+
+	w.Header().Del("Deprecation")
+
+	now := time.Now()
+
+	if fq.Cursor != nil {
+		pinned, err := time.Parse(time.RFC3339Nano, fq.Cursor.Pin)
+
+		if err != nil {
+			app.badRequestResponse(w, r, cursor.ErrInvalid)
+			return
+		}
+
+		now = pinned
+	}
+
+	candidates, err := app.store.Engagement.GetRankingCandidates(r.Context(), user.ID, now.Add(-rankedFeedWindow), now, fq, rankedFeedCandidates)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ranked := ranking.Rank(toRankingCandidates(candidates), now, ranking.DefaultWeights)
+
+	if fq.Cursor != nil {
+		score, err := strconv.ParseFloat(fq.Cursor.At, 64)
+
+		if err != nil {
+			app.badRequestResponse(w, r, cursor.ErrInvalid)
+			return
+		}
+
+		// the first candidate ranked after the cursor, or at it when paging
+		// backwards
+		i := slices.IndexFunc(ranked, func(s ranking.Scored) bool {
+			c := ranking.Compare(s, score, fq.Cursor.ID)
+			return c > 0 || c == 0 && fq.Cursor.Before
+		})
+
+		if i < 0 {
+			i = len(ranked)
+		}
+
+		// the candidates past the cursor, in the order they are walked
+		if fq.Cursor.Before {
+			ranked = slices.Clone(ranked[:i])
+			slices.Reverse(ranked)
+		} else {
+			ranked = ranked[i:]
+		}
+	}
+
+	entries, err := app.hydrateRanked(r, user.ID, ranked, fq.Limit+1)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	entries, page := store.Paginate(entries, fq, func(e rankedPost) (string, int64) {
+		return strconv.FormatFloat(e.score, 'g', -1, 64), e.ID
+	})
+
+	pin := now.Format(time.RFC3339Nano)
+
+	for _, c := range []*cursor.Cursor{page.Next, page.Prev} {
+		if c != nil {
+			c.Pin = pin
+		}
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, entries, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// hydrateRanked loads the posts of the ranked candidates in order, until
+// limit of them could be loaded: candidates may have been deleted or hidden
+// since they were ranked.
+func (app *application) hydrateRanked(r *http.Request, userID int64, ranked []ranking.Scored, limit int) ([]rankedPost, error) {
+	entries := []rankedPost{}
+
+	for len(ranked) > 0 && len(entries) < limit {
+		batch := ranked[:min(limit-len(entries), len(ranked))]
+		ranked = ranked[len(batch):]
+
+		ids := make([]int64, len(batch))
+
+		for i, s := range batch {
+			ids[i] = s.PostID
+		}
+
+		posts, err := app.store.Posts.GetFeedByIds(r.Context(), userID, ids, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		byID := make(map[int64]store.PostWithMetaData, len(posts))
+
+		for _, p := range posts {
+			byID[p.ID] = p
+		}
+
+		for _, s := range batch {
+			p, ok := byID[s.PostID]
+
+			if !ok {
+				continue
+			}
+
+			entry := rankedPost{PostWithMetaData: p, score: s.Score}
+
+			if explainRanking {
+				entry.Explanation = &s.Explanation
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func toRankingCandidates(found []store.RankingCandidate) []ranking.Candidate {
+	candidates := make([]ranking.Candidate, len(found))
+
+	for i, c := range found {
+		candidates[i] = ranking.Candidate{
+			PostID:       c.PostID,
+			AuthorID:     c.AuthorID,
+			At:           c.At,
+			Source:       c.Source,
+			Comments:     c.Comments,
+			Reposts:      c.Reposts,
+			Bookmarks:    c.Bookmarks,
+			Votes:        c.Votes,
+			Interactions: c.Interactions,
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,7 @@
+//go:build debug
+
+package main
+
+// explainRanking adds the breakdown of their score to the posts of the
+// ranked feed. Build with -tags debug to enable it.
+const explainRanking = true
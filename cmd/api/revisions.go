@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rpstvs/social/internal/store"
+)
+
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostfromCtx(r)
+
+	revisions, err := app.store.Revisions.GetByPost(r.Context(), post.ID)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getPostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostfromCtx(r)
+
+	revision, ok := app.readRevision(w, r, post.ID)
+
+	if !ok {
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revision); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// restorePostRevisionHandler brings back the title and content of an older
+// revision. The restore is an edit itself, so the replaced text is kept as a
+// new revision.
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostfromCtx(r)
+	user := getUserFromContext(r)
+
+	revision, ok := app.readRevision(w, r, post.ID)
+
+	if !ok {
+		return
+	}
+
+	post.Title = revision.Title
+	post.Content = revision.Content
+	post.EditorID = user.ID
+
+	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEditConflict):
+			app.preconditionFailedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateCachedPost(r.Context(), post.ID, post.Version)
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) readRevision(w http.ResponseWriter, r *http.Request, postID int64) (*store.PostRevision, bool) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	revision, err := app.store.Revisions.GetByVersion(r.Context(), postID, version)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return revision, true
+}
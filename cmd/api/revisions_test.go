@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rpstvs/social/internal/store"
+)
+
+// fakeRevisions holds the revisions of post 1.
+type fakeRevisions map[int]store.PostRevision
+
+func (f fakeRevisions) GetByPost(ctx context.Context, postID int64) ([]store.PostRevision, error) {
+	var revisions []store.PostRevision
+
+	for _, rev := range f {
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
+
+func (f fakeRevisions) GetByVersion(ctx context.Context, postID int64, version int) (*store.PostRevision, error) {
+	rev, ok := f[version]
+
+	if !ok || postID != 1 {
+		return nil, store.ErrNotFound
+	}
+
+	return &rev, nil
+}
+
+// withURLParams routes the request as chi would with the given parameters.
+func withURLParams(r *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestReadRevision(t *testing.T) {
+	app := NewTestApplication(t, config{})
+	app.store.Revisions = fakeRevisions{
+		2: {PostID: 1, Version: 2, Title: "second"},
+	}
+
+	tests := []struct {
+		name    string
+		postID  int64
+		version string
+		status  int
+		title   string
+	}{
+		{"existing version", 1, "2", http.StatusOK, "second"},
+		{"unknown version", 1, "3", http.StatusNotFound, ""},
+		{"version of another post", 2, "2", http.StatusNotFound, ""},
+		{"malformed version", 1, "two", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withURLParams(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"version": tt.version})
+			w := httptest.NewRecorder()
+
+			rev, ok := app.readRevision(w, r, tt.postID)
+
+			if ok != (tt.status == http.StatusOK) {
+				t.Fatalf("readRevision() ok = %v, want %v", ok, tt.status == http.StatusOK)
+			}
+
+			if !ok {
+				checkResponseCode(t, tt.status, w.Code)
+				return
+			}
+
+			if rev.Title != tt.title {
+				t.Errorf("readRevision() title = %q, want %q", rev.Title, tt.title)
+			}
+		})
+	}
+}
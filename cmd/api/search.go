@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rpstvs/social/internal/cursor"
+	"github.com/rpstvs/social/internal/search"
+	"github.com/rpstvs/social/internal/store"
+)
+
+// postSearchResult is a post matching a search, with its relevance, an HTML
+// snippet of its content and its title in HTML, where the matches are wrapped
+// in <mark> tags.
+type postSearchResult struct {
+	store.Post
+	Rank         float64 `json:"rank"`
+	Snippet      string  `json:"snippet"`
+	TitleSnippet string  `json:"title_snippet"`
+}
+
+// searchHandler searches posts, comments or users depending on the type
+// parameter, posts by default. Only what the viewer can read is returned.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if q == "" || len(q) > 100 {
+		app.badRequestResponse(w, r, errors.New("q must be between 1 and 100 characters"))
+		return
+	}
+
+	kind := r.URL.Query().Get("type")
+
+	// users are listed alphabetically, the rest by relevance
+	sort := "desc"
+
+	if kind == "users" {
+		sort = "asc"
+	}
+
+	fq, err := app.readPageQuery(w, r, sort)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	var (
+		results any
+		page    store.Page
+	)
+
+	switch kind {
+	case "", "posts":
+		results, page, err = app.searchPosts(r.Context(), user.ID, q, fq)
+	case "comments":
+		results, page, err = app.store.Search.SearchComments(r.Context(), user.ID, q, fq)
+	case "users":
+		results, page, err = app.store.Search.SearchUsers(r.Context(), q, fq)
+	default:
+		app.badRequestResponse(w, r, errors.New("type must be posts, comments or users"))
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, cursor.ErrInvalid):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, results, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// searchPosts queries the search index, then loads the matching posts the
+// viewer can read. Pages may come out short when some cannot be read.
+func (app *application) searchPosts(ctx context.Context, viewerID int64, q string, fq store.PaginatedFeedQuery) ([]postSearchResult, store.Page, error) {
+	query := search.Query{Text: q, Limit: fq.Limit + 1}
+
+	if fq.Cursor != nil {
+		rank, err := strconv.ParseFloat(fq.Cursor.At, 64)
+
+		if err != nil {
+			return nil, store.Page{}, cursor.ErrInvalid
+		}
+
+		query.After = &search.Hit{PostID: fq.Cursor.ID, Rank: rank}
+		query.Before = fq.Cursor.Before
+	}
+
+	hits, err := app.searchIndex.Search(ctx, query)
+
+	if err != nil {
+		return nil, store.Page{}, err
+	}
+
+	hits, page := store.Paginate(hits, fq, search.Hit.Key)
+
+	ids := make([]int64, len(hits))
+
+	for i, h := range hits {
+		ids[i] = h.PostID
+	}
+
+	posts, err := app.getPostsByIds(ctx, ids, viewerID)
+
+	if err != nil {
+		return nil, store.Page{}, err
+	}
+
+	byID := make(map[int64]store.Post, len(posts))
+
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+
+	results := []postSearchResult{}
+
+	for _, h := range hits {
+		if p, ok := byID[h.PostID]; ok {
+			results = append(results, postSearchResult{Post: p, Rank: h.Rank, Snippet: h.Snippet, TitleSnippet: h.Title})
+		}
+	}
+
+	return results, page, nil
+}
+
+// runSearchSync applies the search outbox to the search index until ctx is
+// cancelled. Every API instance may run it: entries are leased to one
+// worker at a time.
+func (app *application) runSearchSync(ctx context.Context) {
+	if !app.config.search.syncEnabled {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.search.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				synced, err := app.syncSearchIndex(ctx)
+
+				if err != nil {
+					if ctx.Err() == nil {
+						app.logger.Errorw("couldnt sync search index", "error", err)
+					}
+					break
+				}
+
+				if synced < app.config.search.syncBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// syncSearchIndex applies one batch of the outbox, returning its size.
+func (app *application) syncSearchIndex(ctx context.Context) (int, error) {
+	syncs, err := app.store.Search.ClaimSearchSyncs(ctx, app.config.search.syncBatchSize, app.config.search.syncLease)
+
+	if err != nil || len(syncs) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int64, len(syncs))
+	postIDs := make([]int64, len(syncs))
+
+	for i, s := range syncs {
+		ids[i] = s.ID
+		postIDs[i] = s.PostID
+	}
+
+	docs, err := app.store.Search.GetSearchDocuments(ctx, postIDs)
+
+	if err != nil {
+		return 0, err
+	}
+
+	live := make(map[int64]bool, len(docs))
+
+	for _, d := range docs {
+		live[d.PostID] = true
+	}
+
+	// the posts without a document were deleted, unpublished or purged
+	var gone []int64
+
+	for _, id := range postIDs {
+		if !live[id] {
+			gone = append(gone, id)
+		}
+	}
+
+	if err := app.searchIndex.Upsert(ctx, toSearchDocuments(docs)); err != nil {
+		return 0, err
+	}
+
+	if err := app.searchIndex.Delete(ctx, gone); err != nil {
+		return 0, err
+	}
+
+	return len(syncs), app.store.Search.AckSearchSyncs(ctx, ids)
+}
+
+func toSearchDocuments(found []store.SearchDocument) []search.Document {
+	docs := make([]search.Document, len(found))
+
+	for i, d := range found {
+		docs[i] = search.Document{
+			PostID:      d.PostID,
+			UserID:      d.UserID,
+			Title:       d.Title,
+			Content:     d.Content,
+			Tags:        d.Tags,
+			PublishedAt: d.PublishedAt,
+			Version:     d.Version,
+		}
+	}
+
+	return docs
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rpstvs/social/internal/entities"
+	"github.com/rpstvs/social/internal/store"
+)
+
+// tagParam returns the normalized tag from the URL, so that /tags/Go and
+// /tags/%EF%BC%A7o land on the same page.
+func tagParam(r *http.Request) (string, error) {
+	raw, err := url.PathUnescape(chi.URLParam(r, "tag"))
+
+	if err != nil {
+		return "", err
+	}
+
+	tag := entities.NormalizeTag(raw)
+
+	if tag == "" {
+		return "", errors.New("empty tag")
+	}
+
+	return tag, nil
+}
+
+func (app *application) getTagHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := tagParam(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	tag, err := app.store.Tags.GetByName(r.Context(), name, user.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tag); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := tagParam(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	fq, err := app.readPageQuery(w, r, "desc")
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	posts, page, err := app.store.Posts.GetByTag(r.Context(), name, user.ID, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := tagParam(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Tags.Follow(r.Context(), user.ID, name); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := tagParam(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Tags.Unfollow(r.Context(), user.ID, name); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTagParam(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"go", "go", false},
+		{"Go", "go", false},
+		{"%EF%BC%A7o", "go", false},
+		{"%23Go", "go", false},
+		{"cr%C3%A8me", "crème", false},
+		{"%23", "", true},
+		{"%20", "", true},
+		{"%zz", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			r := withURLParams(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"tag": tt.raw})
+
+			got, err := tagParam(r)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("tagParam(%q) = %q, want an error", tt.raw, got)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("tagParam(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rpstvs/social/internal/cursor"
+	"github.com/rpstvs/social/internal/store"
+	"github.com/rpstvs/social/internal/timeline"
+)
+
+// timelineJob is either the fan-out of a newly published post or the
+// rebuild of a user's timeline.
+type timelineJob struct {
+	postID int64
+	userID int64
+}
+
+// pushToTimelines queues the fan-out of a post that just got published.
+func (app *application) pushToTimelines(postID int64) {
+	app.enqueueTimelineJob(timelineJob{postID: postID})
+}
+
+// rebuildTimeline queues the rebuild of the user's timeline, after they
+// followed or unfollowed someone.
+func (app *application) rebuildTimeline(userID int64) {
+	app.enqueueTimelineJob(timelineJob{userID: userID})
+}
+
+const (
+	// timelineEnqueueTimeout bounds how long a request waits for the
+	// timeline workers when they are behind.
+	timelineEnqueueTimeout = 100 * time.Millisecond
+	// timelineReadRounds bounds the batches read to fill a page when
+	// entries turn out to be deleted, hidden or superseded.
+	timelineReadRounds = 5
+)
+
+// enqueueTimelineJob waits a little for the workers when they are behind. A
+// job that still does not fit is not lost: the timelines it would have
+// updated are marked for rebuild instead, and are read from the database
+// until then.
+func (app *application) enqueueTimelineJob(job timelineJob) {
+	if app.timelines == nil {
+		return
+	}
+
+	select {
+	case app.timelineJobs <- job:
+		return
+	case <-time.After(timelineEnqueueTimeout):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timelineEnqueueTimeout)
+	defer cancel()
+
+	var err error
+
+	// the followers reached by a fan-out are not known here, so every
+	// timeline is rebuilt
+	if job.postID != 0 {
+		err = app.timelines.MarkStale(ctx)
+	} else {
+		err = app.timelines.Invalidate(ctx, job.userID)
+	}
+
+	app.logger.Warnw("timeline queue full, marking timelines for rebuild", "post", job.postID, "user", job.userID)
+
+	if err != nil {
+		app.logger.Errorw("couldnt mark timelines for rebuild", "post", job.postID, "user", job.userID, "error", err)
+	}
+}
+
+// runTimelineWorkers processes timeline jobs until ctx is cancelled.
+func (app *application) runTimelineWorkers(ctx context.Context) {
+	if app.timelines == nil {
+		return
+	}
+
+	for range app.config.timeline.workers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-app.timelineJobs:
+					var err error
+
+					if job.postID != 0 {
+						err = app.fanOut(ctx, job.postID)
+					} else {
+						err = app.buildTimeline(ctx, job.userID)
+					}
+
+					if err != nil && ctx.Err() == nil {
+						app.logger.Errorw("couldnt update timelines", "post", job.postID, "user", job.userID, "error", err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// fanOut pushes the post to the timelines of its author and of their
+// followers. The posts of celebrities are only pushed to their own timeline:
+// their followers pull them when reading.
+func (app *application) fanOut(ctx context.Context, postID int64) error {
+	post, err := app.store.Posts.GetById(ctx, postID)
+
+	if err != nil {
+		return err
+	}
+
+	if post.Status != store.StatusPublished || post.PublishedAt == nil {
+		return nil
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, *post.PublishedAt)
+
+	if err != nil {
+		return err
+	}
+
+	count, err := app.store.Followers.CountFollowers(ctx, post.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	userIDs := []int64{post.UserID}
+
+	if count < app.config.timeline.celebrityThreshold {
+		followers, err := app.store.Followers.GetFollowerIDs(ctx, post.UserID)
+
+		if err != nil {
+			return err
+		}
+
+		userIDs = append(userIDs, followers...)
+	}
+
+	return app.timelines.Push(ctx, userIDs, timeline.Entry{PostID: post.ID, At: at})
+}
+
+// buildTimeline replaces the user's timeline with the latest posts pushed to
+// it, read from the database.
+func (app *application) buildTimeline(ctx context.Context, userID int64) error {
+	builtAt := time.Now()
+	fq := store.PaginatedFeedQuery{Limit: app.config.timeline.capacity, Sort: "desc"}
+
+	found, err := app.store.Posts.GetFeedEntries(ctx, userID, app.config.timeline.celebrityThreshold, true, fq)
+
+	if err != nil {
+		return err
+	}
+
+	return app.timelines.Replace(ctx, userID, toTimelineEntries(found), builtAt)
+}
+
+// readTimeline reads a page of the user's home timeline from Redis, merged
+// with the posts pulled from celebrities and followed tags. Entries whose
+// post was deleted, hidden from the user or shows up later in the feed are
+// skipped, and further entries read in their place. ok is false when the
+// timeline is not built yet, in which case a rebuild is queued and the caller
+// falls back to GetUserFeed.
+func (app *application) readTimeline(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) (feed []store.PostWithMetaData, page store.Page, ok bool, err error) {
+	ascending := fq.Cursor != nil && fq.Cursor.Before
+
+	var from *timeline.Entry
+
+	if fq.Cursor != nil {
+		at, err := time.Parse(time.RFC3339Nano, fq.Cursor.At)
+
+		if err != nil {
+			return nil, page, false, cursor.ErrInvalid
+		}
+
+		from = &timeline.Entry{PostID: fq.Cursor.ID, At: at}
+	}
+
+	exhausted := false
+
+	for round := 0; round < timelineReadRounds && len(feed) <= fq.Limit; round++ {
+		entries, ok, err := app.timelineEntries(ctx, userID, from, ascending, fq.Limit+1)
+
+		if err != nil || !ok {
+			return nil, page, ok, err
+		}
+
+		exhausted = len(entries) <= fq.Limit
+
+		if len(entries) == 0 {
+			break
+		}
+
+		from = &entries[len(entries)-1]
+
+		ids := make([]int64, len(entries))
+
+		for i, e := range entries {
+			ids[i] = e.PostID
+		}
+
+		found, err := app.store.Posts.GetFeedByIds(ctx, userID, ids, true)
+
+		if err != nil {
+			return nil, page, true, err
+		}
+
+		// GetFeedByIds returns the most recent first
+		if ascending {
+			slices.Reverse(found)
+		}
+
+		feed = append(feed, found...)
+
+		if exhausted {
+			break
+		}
+	}
+
+	filled := len(feed) > fq.Limit
+
+	if filled {
+		feed = feed[:fq.Limit+1]
+	}
+
+	feed, page = store.Paginate(feed, fq, store.PostWithMetaData.FeedPosition)
+
+	// the rounds ran out before the page was filled: the next page starts
+	// after the last entry read, not the last one returned
+	if !filled && !exhausted && from != nil {
+		next := &cursor.Cursor{At: from.At.Format(time.RFC3339Nano), ID: from.PostID, Before: ascending}
+
+		if ascending {
+			page.Prev = next
+		} else {
+			page.Next = next
+		}
+	}
+
+	return feed, page, true, nil
+}
+
+// timelineEntries reads up to limit entries of the user's home timeline past
+// the from entry: the ones pushed to it, from Redis or from the database
+// past the capacity kept in Redis, merged with the ones pulled at read time.
+func (app *application) timelineEntries(ctx context.Context, userID int64, from *timeline.Entry, ascending bool, limit int) ([]timeline.Entry, bool, error) {
+	fq := store.PaginatedFeedQuery{Limit: limit, Sort: "desc"}
+
+	if from != nil {
+		fq.Cursor = &cursor.Cursor{At: from.At.Format(time.RFC3339Nano), ID: from.PostID, Before: ascending}
+	}
+
+	pushed, ok, err := app.timelines.Range(ctx, userID, from, ascending, limit)
+
+	switch {
+	case errors.Is(err, timeline.ErrTruncated):
+		found, err := app.store.Posts.GetFeedEntries(ctx, userID, app.config.timeline.celebrityThreshold, true, fq)
+
+		if err != nil {
+			return nil, true, err
+		}
+
+		pushed = toTimelineEntries(found)
+	case err != nil:
+		return nil, ok, err
+	case !ok:
+		app.rebuildTimeline(userID)
+		return nil, false, nil
+	}
+
+	pulled, err := app.store.Posts.GetFeedEntries(ctx, userID, app.config.timeline.celebrityThreshold, false, fq)
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	entries := timeline.Merge(ascending, pushed, toTimelineEntries(pulled))
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, true, nil
+}
+
+func toTimelineEntries(found []store.FeedEntry) []timeline.Entry {
+	entries := make([]timeline.Entry, len(found))
+
+	for i, e := range found {
+		entries[i] = timeline.Entry{PostID: e.PostID, At: e.At}
+	}
+
+	return entries
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rpstvs/social/internal/store"
+)
+
+// getTrashHandler lists the caller's deleted posts. Moderators can pass
+// all=true to list the trash of every user.
+func (app *application) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	userID := &user.ID
+
+	if r.URL.Query().Get("all") == "true" {
+		allowed, err := app.checkRolePrecedence(r.Context(), user, "moderator")
+
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r, fmt.Errorf("forbidden"))
+			return
+		}
+
+		userID = nil
+	}
+
+	trash, err := app.store.Posts.GetTrash(r.Context(), userID, app.config.trash.retention, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, trash); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	post, err := app.store.Posts.GetDeletedById(ctx, id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if restoreNeedsModerator(post, user.ID) {
+		allowed, err := app.checkRolePrecedence(ctx, user, "moderator")
+
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !allowed {
+			app.forbiddenResponse(w, r, fmt.Errorf("forbidden"))
+			return
+		}
+	}
+
+	if err := app.store.Posts.Restore(ctx, id, app.config.trash.retention); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateCachedPost(ctx, id, post.Version)
+	// timelines rebuilt while the post was in the trash left it out
+	app.pushToTimelines(id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreNeedsModerator reports whether restoring the post takes a
+// moderator: authors can restore their own deletions, but not what a
+// moderator took down.
+func restoreNeedsModerator(post *store.Post, userID int64) bool {
+	deletedByOther := post.DeletedBy != nil && *post.DeletedBy != post.UserID
+
+	return post.UserID != userID || deletedByOther
+}
+
+// runTrashPurger hard-deletes posts whose retention window has expired until
+// ctx is cancelled.
+func (app *application) runTrashPurger(ctx context.Context) {
+	if !app.config.trash.purgeEnabled {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := app.store.Posts.PurgeDeleted(ctx, app.config.trash.retention, app.config.trash.purgeBatchSize)
+
+			if err != nil {
+				app.logger.Errorw("couldnt purge deleted posts", "error", err)
+				continue
+			}
+
+			if purged > 0 {
+				app.logger.Infow("purged deleted posts", "count", purged)
+			}
+		}
+	}
+}
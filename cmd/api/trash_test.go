@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+func TestRestoreNeedsModerator(t *testing.T) {
+	author, moderator := int64(1), int64(2)
+
+	tests := []struct {
+		name      string
+		deletedBy *int64
+		userID    int64
+		want      bool
+	}{
+		{"author restores their own deletion", &author, author, false},
+		{"author restores a deletion of unknown origin", nil, author, false},
+		{"author restores a moderator takedown", &moderator, author, true},
+		{"someone else restores the author's deletion", &author, moderator, true},
+		{"moderator restores their takedown", &moderator, moderator, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &store.Post{UserID: author, DeletedBy: tt.deletedBy}
+
+			if got := restoreNeedsModerator(post, tt.userID); got != tt.want {
+				t.Errorf("restoreNeedsModerator() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRoles knows the moderator role only.
+type fakeRoles struct{}
+
+func (fakeRoles) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	if name != "moderator" {
+		return nil, store.ErrNotFound
+	}
+
+	return &store.Role{ID: 2, Name: "moderator", Level: 2}, nil
+}
+
+func TestGetTrashOfEveryUserForbidden(t *testing.T) {
+	app := NewTestApplication(t, config{})
+	app.store.Roles = fakeRoles{}
+
+	user := &store.User{ID: 1, Role: store.Role{ID: 1, Name: "user", Level: 1}}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/posts/trash?all=true", nil)
+	r = r.WithContext(context.WithValue(r.Context(), CTX_USER_KEY, user))
+	w := httptest.NewRecorder()
+
+	app.getTrashHandler(w, r)
+
+	checkResponseCode(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+	"github.com/rpstvs/social/internal/trending"
+)
+
+const (
+	trendingKindPosts = "posts"
+	trendingKindTags  = "tags"
+	// trendingMaxItems is how many items are kept per ranking.
+	trendingMaxItems = 100
+)
+
+var (
+	postTrendingRules = trending.Rules{
+		Weights: map[string]float64{
+			store.EngagementComment:  2,
+			store.EngagementRepost:   3,
+			store.EngagementQuote:    4,
+			store.EngagementBookmark: 1,
+			store.EngagementVote:     0.5,
+		},
+		MinUsers: 2,
+	}
+	tagTrendingRules = trending.Rules{
+		Weights:  map[string]float64{store.EngagementTagUse: 1},
+		MinUsers: 3,
+	}
+)
+
+func trendingKey(kind string, window trending.Window) string {
+	return kind + ":" + window.Name
+}
+
+// runTrendingJob recomputes the trending rankings every interval until ctx
+// is cancelled. Every instance may run it: the result is the same.
+func (app *application) runTrendingJob(ctx context.Context) {
+	if !app.config.trending.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.trending.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := app.computeTrending(ctx); err != nil && ctx.Err() == nil {
+			app.logger.Errorw("couldnt compute trending", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) computeTrending(ctx context.Context) error {
+	now := time.Now()
+
+	for _, window := range trending.Windows {
+		posts, err := app.store.Engagement.GetTrendingPosts(ctx, trendingQuery(window, postTrendingRules, now))
+
+		if err != nil {
+			return err
+		}
+
+		if err := app.trending.Replace(ctx, trendingKey(trendingKindPosts, window), toTrendingItems(posts)); err != nil {
+			return err
+		}
+
+		tags, err := app.store.Engagement.GetTrendingTags(ctx, trendingQuery(window, tagTrendingRules, now))
+
+		if err != nil {
+			return err
+		}
+
+		if err := app.trending.Replace(ctx, trendingKey(trendingKindTags, window), toTrendingItems(tags)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func trendingQuery(window trending.Window, rules trending.Rules, now time.Time) store.TrendingQuery {
+	return store.TrendingQuery{
+		Now:      now,
+		Span:     window.Span,
+		HalfLife: window.HalfLife,
+		Weights:  rules.Weights,
+		MinUsers: rules.MinUsers,
+		Limit:    trendingMaxItems,
+	}
+}
+
+func toTrendingItems(scores []store.TrendingScore) []trending.Item {
+	items := make([]trending.Item, len(scores))
+
+	for i, s := range scores {
+		items[i] = trending.Item{ID: s.ID, Score: s.Score}
+	}
+
+	return items
+}
+
+type trendingTag struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+type trendingPost struct {
+	store.Post
+	Score float64 `json:"score"`
+}
+
+type trendingResponse struct {
+	Window string         `json:"window"`
+	Tags   []trendingTag  `json:"tags"`
+	Posts  []trendingPost `json:"posts"`
+}
+
+// exploreTrendingHandler returns the trending tags and posts of the window
+// given by ?window=day|week, day by default. Posts the viewer cannot read are
+// skipped.
+func (app *application) exploreTrendingHandler(w http.ResponseWriter, r *http.Request) {
+	window := trending.Day
+
+	if name := r.URL.Query().Get("window"); name != "" {
+		found := false
+
+		for _, wd := range trending.Windows {
+			if wd.Name == name {
+				window, found = wd, true
+			}
+		}
+
+		if !found {
+			app.badRequestResponse(w, r, fmt.Errorf("unknown window %q", name))
+			return
+		}
+	}
+
+	limit := 20
+
+	if param := r.URL.Query().Get("limit"); param != "" {
+		l, err := strconv.Atoi(param)
+
+		if err != nil || l < 1 || l > 50 {
+			app.badRequestResponse(w, r, fmt.Errorf("limit must be between 1 and 50"))
+			return
+		}
+		limit = l
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	response := trendingResponse{
+		Window: window.Name,
+		Tags:   []trendingTag{},
+		Posts:  []trendingPost{},
+	}
+
+	tags, err := app.trending.Top(ctx, trendingKey(trendingKindTags, window), limit)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for _, t := range tags {
+		response.Tags = append(response.Tags, trendingTag{Name: t.ID, Score: t.Score})
+	}
+
+	ranked, err := app.trending.Top(ctx, trendingKey(trendingKindPosts, window), limit)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ids := make([]int64, 0, len(ranked))
+	scores := make(map[int64]float64, len(ranked))
+
+	for _, item := range ranked {
+		id, err := strconv.ParseInt(item.ID, 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		ids = append(ids, id)
+		scores[id] = item.Score
+	}
+
+	posts, err := app.getPostsByIds(ctx, ids, user.ID)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	byID := make(map[int64]store.Post, len(posts))
+
+	for _, p := range posts {
+		byID[p.ID] = p
+	}
+
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			response.Posts = append(response.Posts, trendingPost{Post: p, Score: scores[id]})
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, response); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+	"github.com/rpstvs/social/internal/trending"
+)
+
+func TestTrendingQuery(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		window trending.Window
+		rules  trending.Rules
+	}{
+		{"posts of the day", trending.Day, postTrendingRules},
+		{"tags of the week", trending.Week, tagTrendingRules},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := trendingQuery(tt.window, tt.rules, now)
+
+			if !q.Now.Equal(now) || q.Span != tt.window.Span || q.HalfLife != tt.window.HalfLife {
+				t.Errorf("query window = %v, %v, %v, want %v, %v, %v", q.Now, q.Span, q.HalfLife, now, tt.window.Span, tt.window.HalfLife)
+			}
+
+			if q.MinUsers != tt.rules.MinUsers || len(q.Weights) != len(tt.rules.Weights) {
+				t.Errorf("query rules = %d, %v, want %d, %v", q.MinUsers, q.Weights, tt.rules.MinUsers, tt.rules.Weights)
+			}
+
+			if q.Limit != trendingMaxItems {
+				t.Errorf("Limit = %d, want %d", q.Limit, trendingMaxItems)
+			}
+		})
+	}
+}
+
+func TestToTrendingItems(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []store.TrendingScore
+		want   []trending.Item
+	}{
+		{"keeps the order", []store.TrendingScore{{ID: "7", Score: 3.5}, {ID: "go", Score: 1}}, []trending.Item{{ID: "7", Score: 3.5}, {ID: "go", Score: 1}}},
+		{"nothing trending", nil, []trending.Item{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toTrendingItems(tt.scores); !slices.Equal(got, tt.want) {
+				t.Errorf("toTrendingItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrendingKey(t *testing.T) {
+	if got, want := trendingKey(trendingKindTags, trending.Week), "tags:week"; got != want {
+		t.Errorf("trendingKey() = %q, want %q", got, want)
+	}
+}
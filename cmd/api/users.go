@@ -15,7 +15,7 @@ type userKey string
 var CTX_USER_KEY userKey = "user"
 
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "userId")
+	idParam := chi.URLParam(r, "userID")
 
 	id, err := strconv.ParseInt(idParam, 10, 64)
 
@@ -59,6 +59,9 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		app.internalServerError(w, r, err)
 		return
 	}
+
+	app.rebuildTimeline(user.ID)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -78,16 +81,56 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		app.internalServerError(w, r, err)
 		return
 	}
+
+	app.rebuildTimeline(user.ID)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// getFollowersHandler lists the users following the user in the URL.
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowers(w, r, app.store.Followers.GetFollowers)
+}
+
+// getFollowingHandler lists the users the user in the URL follows.
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollowers(w, r, app.store.Followers.GetFollowing)
+}
+
+func (app *application) listFollowers(w http.ResponseWriter, r *http.Request, list func(context.Context, int64, store.PaginatedFeedQuery) ([]store.FollowUser, store.Page, error)) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, errors.New("invalid user id"))
+		return
+	}
+
+	fq, err := app.readPageQuery(w, r, "desc")
+
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	users, page, err := list(r.Context(), id, fq)
+
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, users, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 
-	err := app.store.Users.Activate(r.Context(), token)
+	userID, err := app.store.Users.Activate(r.Context(), token)
 
 	if err != nil {
 		switch err {
@@ -98,11 +141,13 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+
+	app.invalidateUser(r.Context(), userID)
 }
 
 func (app *application) UserHandlerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		idParam := chi.URLParam(r, "userId")
+		idParam := chi.URLParam(r, "userID")
 
 		id, err := strconv.ParseInt(idParam, 10, 64)
 
@@ -135,3 +180,33 @@ func getUserFromContext(r *http.Request) *store.User {
 
 	return user
 }
+
+type setAvatarPayload struct {
+	// AttachmentID is an image uploaded through /media; null removes the avatar.
+	AttachmentID *int64 `json:"attachment_id"`
+}
+
+func (app *application) setAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	var payload setAvatarPayload
+
+	if err := ReadJson(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Users.SetAvatar(r.Context(), user.ID, payload.AttachmentID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrAttachmentUnavailable):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUser(r.Context(), user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
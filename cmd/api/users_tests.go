@@ -13,6 +13,10 @@ func TestGetUser(t *testing.T) {
 		redisCfg: RedisConfig{
 			enabled: true,
 		},
+		cache: CacheConfig{
+			enabled: true,
+			backend: "redis",
+		},
 	}
 	app := NewTestApplication(t, withRedis)
 	mux := app.mount()
@@ -75,7 +79,7 @@ func TestGetUser(t *testing.T) {
 	})
 
 	t.Run("should hit the cache first and if not exists it sets the user on the cache", func(t *testing.T) {
-		app.config.redisCfg.enabled = false
+		app.config.cache.enabled = false
 		mockCacheStore := app.cacheStorage.Users.(*cache.MockCacheStorage)
 
 		mockCacheStore.On("Get", int64(42)).Return(nil, nil)
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS bookmark_collections(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE(user_id, name)
+);
+CREATE TABLE IF NOT EXISTS bookmarks(
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    collection_id bigint REFERENCES bookmark_collections(id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY(user_id, post_id)
+);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_collection_id ON bookmarks(collection_id);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks(post_id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS bookmark_collections;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts
+ADD COLUMN repost_of_id bigint;
+ALTER TABLE posts
+ADD COLUMN is_repost BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE posts
+ADD COLUMN repost_count INT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_posts_repost_of_id ON posts(repost_of_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_unique_repost ON posts(user_id, repost_of_id)
+WHERE is_repost;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_posts_unique_repost;
+DROP INDEX IF EXISTS idx_posts_repost_of_id;
+ALTER TABLE posts DROP COLUMN repost_count;
+ALTER TABLE posts DROP COLUMN is_repost;
+ALTER TABLE posts DROP COLUMN repost_of_id;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts
+ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'followers', 'mentioned'));
+CREATE TABLE IF NOT EXISTS post_mentions(
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY(post_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions(user_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers(follower_id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_followers_follower_id;
+DROP TABLE IF EXISTS post_mentions;
+ALTER TABLE posts DROP COLUMN visibility;
+-- +goose StatementEnd
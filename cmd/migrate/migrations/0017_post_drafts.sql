@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'scheduled', 'published'));
+ALTER TABLE posts
+ADD COLUMN publish_at timestamp(0) with time zone;
+ALTER TABLE posts
+ADD COLUMN published_at timestamp(0) with time zone;
+UPDATE posts
+SET published_at = created_at;
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts(publish_at)
+WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_posts_published_at;
+DROP INDEX IF EXISTS idx_posts_scheduled;
+ALTER TABLE posts DROP COLUMN published_at;
+ALTER TABLE posts DROP COLUMN publish_at;
+ALTER TABLE posts DROP COLUMN status;
+-- +goose StatementEnd
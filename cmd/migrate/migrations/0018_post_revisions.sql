@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS post_revisions(
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    edited_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE(post_id, version)
+);
+ALTER TABLE posts
+ADD COLUMN edited_at timestamp(0) with time zone;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE posts DROP COLUMN edited_at;
+DROP TABLE IF EXISTS post_revisions;
+-- +goose StatementEnd
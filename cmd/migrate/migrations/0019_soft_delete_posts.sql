@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE posts
+ADD COLUMN deleted_at timestamp(0) with time zone;
+ALTER TABLE posts
+ADD COLUMN deleted_by bigint REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts(deleted_at)
+WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_posts_unique_repost;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_unique_repost ON posts(user_id, repost_of_id)
+WHERE is_repost
+    AND deleted_at IS NULL;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_posts_unique_repost;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_posts_unique_repost ON posts(user_id, repost_of_id)
+WHERE is_repost;
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+ALTER TABLE posts DROP COLUMN deleted_by;
+ALTER TABLE posts DROP COLUMN deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS attachments(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id bigint REFERENCES posts(id) ON DELETE SET NULL,
+    blob_key text NOT NULL UNIQUE,
+    url text NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size bigint NOT NULL,
+    alt_text text NOT NULL DEFAULT '',
+    position INT NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments(post_id, position);
+CREATE INDEX IF NOT EXISTS idx_attachments_orphans ON attachments(created_at)
+WHERE post_id IS NULL;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS attachments;
+-- +goose StatementEnd
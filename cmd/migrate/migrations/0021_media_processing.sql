@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE attachments
+ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'ready',
+ADD COLUMN width INT,
+ADD COLUMN height INT,
+ADD COLUMN blurhash text NOT NULL DEFAULT '',
+ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN locked_until timestamp(0) with time zone,
+ADD CONSTRAINT attachments_status_check CHECK (status IN ('pending', 'ready', 'failed'));
+-- images uploaded before the pipeline existed still need their variants,
+-- except webp ones, which it cannot decode and keep being served as uploaded
+UPDATE attachments SET status = 'pending'
+WHERE content_type IN ('image/jpeg', 'image/png', 'image/gif');
+CREATE INDEX IF NOT EXISTS idx_attachments_pending ON attachments(id)
+WHERE status = 'pending';
+CREATE TABLE IF NOT EXISTS attachment_variants(
+    attachment_id bigint NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+    name VARCHAR(20) NOT NULL,
+    blob_key text NOT NULL UNIQUE,
+    url text NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size bigint NOT NULL,
+    PRIMARY KEY (attachment_id, name)
+);
+ALTER TABLE users
+ADD COLUMN avatar_id bigint REFERENCES attachments(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_id;
+DROP TABLE IF EXISTS attachment_variants;
+DROP INDEX IF EXISTS idx_attachments_pending;
+ALTER TABLE attachments
+DROP CONSTRAINT IF EXISTS attachments_status_check,
+DROP COLUMN IF EXISTS locked_until,
+DROP COLUMN IF EXISTS attempts,
+DROP COLUMN IF EXISTS blurhash,
+DROP COLUMN IF EXISTS height,
+DROP COLUMN IF EXISTS width,
+DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
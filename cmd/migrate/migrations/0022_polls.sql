@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS polls(
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL UNIQUE REFERENCES posts(id) ON DELETE CASCADE,
+    multiple boolean NOT NULL DEFAULT false,
+    public_results boolean NOT NULL DEFAULT false,
+    voters_count INT NOT NULL DEFAULT 0,
+    expires_at timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS poll_options(
+    id bigserial PRIMARY KEY,
+    poll_id bigint NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    text VARCHAR(100) NOT NULL,
+    votes_count INT NOT NULL DEFAULT 0,
+    UNIQUE (poll_id, position)
+);
+-- one row per user and poll: this is what limits everyone to a single vote,
+-- even on multiple choice polls
+CREATE TABLE IF NOT EXISTS poll_voters(
+    poll_id bigint NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (poll_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS poll_votes(
+    poll_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    option_id bigint NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    PRIMARY KEY (poll_id, user_id, option_id),
+    FOREIGN KEY (poll_id, user_id) REFERENCES poll_voters(poll_id, user_id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS poll_votes;
+DROP TABLE IF EXISTS poll_voters;
+DROP TABLE IF EXISTS poll_options;
+DROP TABLE IF EXISTS polls;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS post_entities(
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('mention', 'hashtag')),
+    start_offset INT NOT NULL,
+    end_offset INT NOT NULL,
+    text text NOT NULL,
+    user_id bigint REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY(post_id, start_offset)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS post_entities;
+-- +goose StatementEnd
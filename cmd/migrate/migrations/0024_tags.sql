@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the same rule as entities.NormalizeTag: surrounding spaces and a leading
+-- '#' dropped, NFKC, lower case; empty and duplicate tags are dropped
+UPDATE posts
+SET tags = ARRAY(
+    SELECT DISTINCT n
+    FROM (
+        SELECT lower(normalize(regexp_replace(btrim(t), '^#', ''), NFKC)) AS n
+        FROM unnest(tags) t
+    ) normalized
+    WHERE n <> ''
+)
+WHERE tags IS NOT NULL;
+CREATE TABLE IF NOT EXISTS tags(
+    name text PRIMARY KEY,
+    first_seen_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+INSERT INTO tags (name, first_seen_at)
+SELECT t, MIN(p.created_at)
+FROM posts p, unnest(p.tags) t
+GROUP BY t
+ON CONFLICT DO NOTHING;
+-- tags can be followed before anyone used them, so there is no foreign key
+-- to tags
+CREATE TABLE IF NOT EXISTS tag_follows(
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tag)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS tag_follows;
+DROP TABLE IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- every search vector is built with the social configuration; altering its
+-- mappings changes the language of search without touching the queries
+CREATE TEXT SEARCH CONFIGURATION social (COPY = pg_catalog.english);
+ALTER TABLE posts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('social', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('social', coalesce(content, '')), 'B')
+) STORED;
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING gin (search_vector);
+ALTER TABLE comments ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector('social', coalesce(content, ''))
+) STORED;
+CREATE INDEX IF NOT EXISTS idx_comments_search ON comments USING gin (search_vector);
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username) text_pattern_ops);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_username_prefix;
+ALTER TABLE comments DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
+DROP TEXT SEARCH CONFIGURATION IF EXISTS social;
+-- +goose StatementEnd
@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+-- search_documents is the postgres search index, kept in sync with posts
+-- through search_outbox
+CREATE TABLE IF NOT EXISTS search_documents(
+    post_id bigint PRIMARY KEY,
+    user_id bigint NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags text[] NOT NULL DEFAULT '{}',
+    published_at timestamp with time zone NOT NULL,
+    indexed_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('social', title), 'A') ||
+        setweight(to_tsvector('social', content), 'B')
+    ) STORED
+);
+CREATE INDEX IF NOT EXISTS idx_search_documents_vector ON search_documents USING gin (search_vector);
+-- a row asks for the document of a post to be refreshed from the posts
+-- table; it is written in the same transaction as the change to the post
+CREATE TABLE IF NOT EXISTS search_outbox(
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    attempts int NOT NULL DEFAULT 0,
+    locked_until timestamp with time zone
+);
+INSERT INTO search_outbox (post_id)
+SELECT id FROM posts WHERE status = 'published' AND deleted_at IS NULL AND NOT is_repost;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS search_outbox;
+DROP TABLE IF EXISTS search_documents;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- keyset pagination orders on (time, id): these indexes serve both sort
+-- directions and the cursor condition without sorting the whole list
+CREATE INDEX IF NOT EXISTS idx_posts_user_published ON posts(user_id, published_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_published ON posts(published_at DESC, id DESC);
+DROP INDEX IF EXISTS idx_posts_published_at;
+CREATE INDEX IF NOT EXISTS idx_comments_post_created ON comments(post_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_followers_user_created ON followers(user_id, created_at DESC, follower_id DESC);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_created ON followers(follower_id, created_at DESC, user_id DESC);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_followers_follower_created;
+DROP INDEX IF EXISTS idx_followers_user_created;
+DROP INDEX IF EXISTS idx_comments_post_created;
+CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at);
+DROP INDEX IF EXISTS idx_posts_published;
+DROP INDEX IF EXISTS idx_posts_user_published;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the version of the post a document was built from, so that an outbox
+-- entry applied late does not overwrite a newer document
+ALTER TABLE search_documents ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE search_documents DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
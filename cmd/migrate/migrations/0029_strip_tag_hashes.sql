@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 0024 used to keep the leading '#' of the tags it normalized: apply the
+-- rule of entities.NormalizeTag again to the posts still carrying one, and
+-- have their search documents refreshed
+WITH renamed AS (
+    UPDATE posts
+    SET tags = ARRAY(
+        SELECT DISTINCT n
+        FROM (
+            SELECT lower(normalize(regexp_replace(btrim(t), '^#', ''), NFKC)) AS n
+            FROM unnest(tags) t
+        ) normalized
+        WHERE n <> ''
+    )
+    WHERE EXISTS (SELECT 1 FROM unnest(tags) t WHERE btrim(t) LIKE '#%')
+    RETURNING id
+)
+INSERT INTO search_outbox (post_id)
+SELECT id FROM renamed;
+INSERT INTO tags (name, first_seen_at)
+SELECT t, MIN(p.created_at)
+FROM posts p, unnest(p.tags) t
+GROUP BY t
+ON CONFLICT (name) DO UPDATE
+SET first_seen_at = LEAST(tags.first_seen_at, EXCLUDED.first_seen_at);
+DELETE FROM tags tg
+WHERE tg.name LIKE '#%' AND NOT EXISTS (SELECT 1 FROM posts p WHERE p.tags @> ARRAY[tg.name]);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+-- the tags are not put back the way they were typed
+SELECT 1;
+-- +goose StatementEnd
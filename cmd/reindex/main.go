@@ -0,0 +1,77 @@
+// Command reindex rebuilds the search index from the posts table. The index
+// keeps serving searches meanwhile: every document is upserted, then the ones
+// left untouched, of posts that no longer have one, are removed. Posts
+// changed while it runs are picked up by the search outbox.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/rpstvs/social/internal/db"
+	"github.com/rpstvs/social/internal/env"
+	"github.com/rpstvs/social/internal/search"
+	"github.com/rpstvs/social/internal/store"
+)
+
+const batchSize = 500
+
+func main() {
+	addr := env.GetString("DB_ADDR", "Fallback")
+	conn, err := db.New(addr, 30, 30, "15m")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	store := store.NewStorage(conn)
+	index := search.NewPostgresIndex(conn)
+
+	ctx := context.Background()
+
+	start, err := index.Now(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var afterID int64
+	var indexed int
+
+	for {
+		found, err := store.Search.ListSearchDocuments(ctx, afterID, batchSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(found) == 0 {
+			break
+		}
+
+		docs := make([]search.Document, len(found))
+
+		for i, d := range found {
+			docs[i] = search.Document{
+				PostID:      d.PostID,
+				UserID:      d.UserID,
+				Title:       d.Title,
+				Content:     d.Content,
+				Tags:        d.Tags,
+				PublishedAt: d.PublishedAt,
+				Version:     d.Version,
+			}
+		}
+
+		if err := index.Upsert(ctx, docs); err != nil {
+			log.Fatal(err)
+		}
+
+		indexed += len(docs)
+		afterID = found[len(found)-1].PostID
+	}
+
+	if err := index.Prune(ctx, start); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("reindexed %d posts", indexed)
+}
@@ -0,0 +1,33 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps uploaded files. Keys are slash separated relative paths such as
+// "attachments/42/0b9c….jpg".
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// cleanKey rejects keys that could escape the store's root.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+
+	if cleaned == "" || cleaned != key || strings.HasPrefix(cleaned, "..") {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
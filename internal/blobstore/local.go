@@ -0,0 +1,102 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs as files under a root directory.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{root: root}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file first so readers never observe a
+// partially written file.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	dst, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	src, err := s.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(src)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	src, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(src)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
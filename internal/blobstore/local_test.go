@@ -0,0 +1,99 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"attachments/42/0b9c.jpg", false},
+		{"variants/42/0b9c/small.jpg", false},
+		{"", true},
+		{"/attachments/42/0b9c.jpg", true},
+		{"../secrets", true},
+		{"attachments/../../secrets", true},
+		{"attachments//42.jpg", true},
+		{"attachments/./42.jpg", true},
+		{"attachments/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := cleanKey(tt.key)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("cleanKey(%q) = %q, %v, want ErrInvalidKey", tt.key, got, err)
+				}
+
+				return
+			}
+
+			if err != nil || got != tt.key {
+				t.Errorf("cleanKey(%q) = %q, %v, want it unchanged", tt.key, got, err)
+			}
+		})
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	key := "attachments/42/0b9c.jpg"
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Put: err = %v, want ErrNotFound", err)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := s.Put(ctx, key, strings.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+
+		rc, err := s.Get(ctx, key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := io.ReadAll(rc)
+		rc.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != content {
+			t.Fatalf("Get = %q, want %q", got, content)
+		}
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+
+	// deleting twice is not an error
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("second Delete: %v", err)
+	}
+
+	if err := s.Put(ctx, "../escape", strings.NewReader("x"), 1, "image/jpeg"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Put outside the root: err = %v, want ErrInvalidKey", err)
+	}
+}
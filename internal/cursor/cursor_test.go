@@ -0,0 +1,65 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignerRoundTrip(t *testing.T) {
+	s := NewSigner("secret")
+
+	tests := []struct {
+		name string
+		c    Cursor
+	}{
+		{"position", Cursor{At: "2026-10-19T12:00:00Z", ID: 42}},
+		{"backwards", Cursor{At: "2026-10-19T12:00:00Z", ID: 42, Before: true}},
+		{"pinned and scoped", Cursor{At: "12.5", ID: 7, Pin: "2026-10-19T11:00:00Z", Scope: "posts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Decode(s.Encode(tt.c))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.c {
+				t.Errorf("Decode(Encode(%+v)) = %+v", tt.c, got)
+			}
+		})
+	}
+}
+
+func TestSignerRejects(t *testing.T) {
+	s := NewSigner("secret")
+	token := s.Encode(Cursor{At: "2026-10-19T12:00:00Z", ID: 42})
+	payload, signature, _ := strings.Cut(token, ".")
+
+	// the same signature over another position
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-10-19T12:00:00Z","i":41}`)) + "." + signature
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"tampered position", forged},
+		{"tampered signature", payload + "." + base64.RawURLEncoding.EncodeToString([]byte("not the signature"))},
+		{"signed with another secret", NewSigner("other secret").Encode(Cursor{At: "2026-10-19T12:00:00Z", ID: 42})},
+		{"signed without a position", s.Encode(Cursor{ID: 42})},
+		{"missing signature", payload},
+		{"not base64", "!!!." + signature},
+		{"empty", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if c, err := s.Decode(tt.token); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Decode() = %+v, %v, want ErrInvalid", c, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package entities extracts @mentions and #hashtags from post content.
+package entities
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	Mention = "mention"
+	Hashtag = "hashtag"
+)
+
+// maxLength bounds the text after the sigil, matching the longest username.
+const maxLength = 100
+
+// Entity is a mention or hashtag found in a text. Start and End are byte
+// offsets of the whole entity, sigil included, so that text[Start:End] is
+// exactly what the author typed. Text is the part after the sigil.
+type Entity struct {
+	Type  string
+	Start int
+	End   int
+	Text  string
+}
+
+// Parse returns the entities of text in order of appearance. A sigil only
+// starts an entity at the beginning of the text or after a character that
+// cannot be part of a word, so e-mail addresses and URL fragments are
+// skipped. Hashtags made only of digits are ignored.
+func Parse(text string) []Entity {
+	var found []Entity
+
+	prev := ' '
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if (r == '@' || r == '#') && !isWordRune(prev) && prev != '@' && prev != '#' {
+			end := i + size
+			letters := 0
+
+			for end < len(text) {
+				next, n := utf8.DecodeRuneInString(text[end:])
+
+				if !isWordRune(next) {
+					break
+				}
+
+				if !unicode.IsDigit(next) {
+					letters++
+				}
+
+				end += n
+			}
+
+			name := text[i+size : end]
+
+			switch {
+			case name == "" || len(name) > maxLength:
+			case r == '@':
+				found = append(found, Entity{Type: Mention, Start: i, End: end, Text: name})
+			case letters > 0:
+				found = append(found, Entity{Type: Hashtag, Start: i, End: end, Text: name})
+			}
+
+			if end > i+size {
+				prev, _ = utf8.DecodeLastRuneInString(text[:end])
+				i = end
+				continue
+			}
+		}
+
+		prev = r
+		i += size
+	}
+
+	return found
+}
+
+// Texts returns the distinct texts of the entities of the given type, in
+// order of first appearance.
+func Texts(found []Entity, entityType string) []string {
+	var texts []string
+	seen := make(map[string]bool)
+
+	for _, e := range found {
+		if e.Type != entityType || seen[e.Text] {
+			continue
+		}
+
+		seen[e.Text] = true
+		texts = append(texts, e.Text)
+	}
+
+	return texts
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
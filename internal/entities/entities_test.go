@@ -0,0 +1,97 @@
+package entities
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Entity
+	}{
+		{
+			name: "mention and hashtag",
+			text: "hi @alice and #golang",
+			want: []Entity{
+				{Type: Mention, Start: 3, End: 9, Text: "alice"},
+				{Type: Hashtag, Start: 14, End: 21, Text: "golang"},
+			},
+		},
+		{
+			name: "after punctuation",
+			text: "(@bob's #go)",
+			want: []Entity{
+				{Type: Mention, Start: 1, End: 5, Text: "bob"},
+				{Type: Hashtag, Start: 8, End: 11, Text: "go"},
+			},
+		},
+		{
+			name: "multibyte text before and in the entity",
+			text: "café #crème",
+			want: []Entity{{Type: Hashtag, Start: 6, End: 13, Text: "crème"}},
+		},
+		{
+			name: "combining mark",
+			text: "#cafe\u0301!",
+			want: []Entity{{Type: Hashtag, Start: 0, End: 7, Text: "cafe\u0301"}},
+		},
+		{
+			name: "digits only hashtag",
+			text: "#123 #go2",
+			want: []Entity{{Type: Hashtag, Start: 5, End: 9, Text: "go2"}},
+		},
+		{"e-mail address", "mail bob@example.com", nil},
+		{"URL fragment", "see example.com/page#anchor", nil},
+		{"doubled sigil", "@@bob ##tag #@bob", nil},
+		{"bare sigil", "@ # @", nil},
+		{"too long", "@" + strings.Repeat("a", maxLength+1), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+
+			for _, e := range got {
+				if typed := tt.text[e.Start:e.End]; typed[1:] != e.Text {
+					t.Errorf("text[%d:%d] = %q, want the sigil and %q", e.Start, e.End, typed, e.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLongest(t *testing.T) {
+	name := strings.Repeat("a", maxLength)
+
+	if got := Parse("@" + name); len(got) != 1 || got[0].Text != name {
+		t.Errorf("Parse() = %+v, want a mention of %d letters", got, maxLength)
+	}
+}
+
+func TestTexts(t *testing.T) {
+	found := Parse("@bob #go @alice #Go #go @bob")
+
+	tests := []struct {
+		entityType string
+		want       []string
+	}{
+		{Mention, []string{"bob", "alice"}},
+		{Hashtag, []string{"go", "Go"}},
+		{"unknown", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entityType, func(t *testing.T) {
+			if got := Texts(found, tt.entityType); !slices.Equal(got, tt.want) {
+				t.Errorf("Texts(%s) = %q, want %q", tt.entityType, got, tt.want)
+			}
+		})
+	}
+}
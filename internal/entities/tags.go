@@ -0,0 +1,37 @@
+package entities
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeTag folds the ways a tag can be typed into a single form: the
+// leading '#' and surrounding spaces are dropped, compatibility characters
+// (full-width letters, ligatures…) are composed with NFKC and the result is
+// lower-cased.
+func NormalizeTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimPrefix(tag, "#")
+
+	return strings.ToLower(norm.NFKC.String(tag))
+}
+
+// NormalizeTags normalizes every tag, dropping empty and duplicate ones.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
@@ -0,0 +1,55 @@
+package entities
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"go", "go"},
+		{"GoLang", "golang"},
+		{"#Go", "go"},
+		{"  #go  ", "go"},
+		{"Ｇｏ", "go"},
+		{"ﬁsh", "fish"},
+		{"crème", "crème"},
+		{"cre\u0300me", "crème"},
+		// only the sigil typed by the author is dropped
+		{"##go", "#go"},
+		{"#", ""},
+		{"   ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := NormalizeTag(tt.tag); got != tt.want {
+				t.Errorf("NormalizeTag(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{"already normalized", []string{"go", "rust"}, []string{"go", "rust"}},
+		{"duplicates after normalization", []string{"Go", "#go", "rust", "Ｇｏ"}, []string{"go", "rust"}},
+		{"empty ones dropped", []string{"", "#", " ", "go"}, []string{"go"}},
+		{"none", nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeTags(tt.tags); !slices.Equal(got, tt.want) {
+				t.Errorf("NormalizeTags(%q) = %q, want %q", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
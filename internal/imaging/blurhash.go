@@ -0,0 +1,118 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes img as a BlurHash placeholder with xComponents by
+// yComponents (1-9 each). Callers should pass a small image: the cost grows
+// with its pixel count.
+func Blurhash(img *image.RGBA, xComponents, yComponents int) string {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			var r, g, bl float64
+
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(w)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(h))
+
+					p := img.PixOffset(b.Min.X+x, b.Min.Y+y)
+					r += basis * srgbToLinear(img.Pix[p])
+					g += basis * srgbToLinear(img.Pix[p+1])
+					bl += basis * srgbToLinear(img.Pix[p+2])
+				}
+			}
+
+			norm := 2.0
+
+			if i == 0 && j == 0 {
+				norm = 1
+			}
+
+			scale := norm / float64(w*h)
+			factors = append(factors, [3]float64{r * scale, g * scale, bl * scale})
+		}
+	}
+
+	var hash strings.Builder
+
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+
+	if len(ac) > 0 {
+		actualMax := 0.0
+
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+
+		quantisedMax := clamp(int(math.Floor(actualMax*166-0.5)), 0, 82)
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	hash.WriteString(encode83(linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4))
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return clamp(int(math.Floor(signPow(v/maxValue, 0.5)*9+9.5)), 0, 18)
+		}
+
+		hash.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+
+	return hash.String()
+}
+
+func encode83(value, length int) string {
+	out := make([]byte, length)
+
+	for i := length - 1; i >= 0; i-- {
+		out[i] = base83[value%83]
+		value /= 83
+	}
+
+	return string(out)
+}
+
+func srgbToLinear(v uint8) float64 {
+	x := float64(v) / 255
+
+	if x <= 0.04045 {
+		return x / 12.92
+	}
+
+	return math.Pow((x+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(hi, v))
+}
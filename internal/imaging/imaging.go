@@ -0,0 +1,156 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	_ "image/gif"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image dimensions exceed the allowed limit")
+)
+
+// VariantSpec describes a resized copy of an upload. Square variants are
+// center-cropped before resizing; the others keep the aspect ratio and fit
+// within MaxSize. Images are never upscaled.
+type VariantSpec struct {
+	Name    string
+	MaxSize int
+	Square  bool
+}
+
+var DefaultVariants = []VariantSpec{
+	{Name: "thumb", MaxSize: 150, Square: true},
+	{Name: "small", MaxSize: 400},
+	{Name: "medium", MaxSize: 800},
+	{Name: "large", MaxSize: 1600},
+}
+
+type Options struct {
+	// MaxPixels bounds width*height as read from the header, before any
+	// pixel is decoded, so decompression bombs are rejected cheaply.
+	MaxPixels int
+	Variants  []VariantSpec
+}
+
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+type Result struct {
+	Width    int
+	Height   int
+	Blurhash string
+	Variants []Variant
+}
+
+// Process decodes an uploaded image and re-encodes it into the requested
+// variants. Re-encoding drops every metadata segment of the original (EXIF,
+// GPS, XMP…); the EXIF orientation is applied to the pixels beforehand so the
+// variants are displayed the right way up.
+func Process(data []byte, opts Options) (*Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > opts.MaxPixels/cfg.Height {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	img := toRGBA(src)
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	bounds := img.Bounds()
+	opaque := img.Opaque()
+
+	result := &Result{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Blurhash: Blurhash(fit(img, 32), 4, 3),
+	}
+
+	for _, spec := range opts.Variants {
+		var resized *image.RGBA
+
+		if spec.Square {
+			resized = fit(cropSquare(img), spec.MaxSize)
+		} else {
+			resized = fit(img, spec.MaxSize)
+		}
+
+		variant, err := encode(spec.Name, resized, opaque)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Variants = append(result.Variants, *variant)
+	}
+
+	return result, nil
+}
+
+// encode writes opaque images as JPEG and keeps PNG for transparency.
+func encode(name string, img *image.RGBA, opaque bool) (*Variant, error) {
+	var buf bytes.Buffer
+
+	variant := &Variant{
+		Name:   name,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+
+	if opaque {
+		variant.ContentType = "image/jpeg"
+
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+	} else {
+		variant.ContentType = "image/png"
+
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	}
+
+	variant.Data = buf.Bytes()
+	return variant, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+func cropSquare(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := (b.Dx() - side) / 2
+	y := (b.Dy() - side) / 2
+
+	return img.SubImage(image.Rect(x, y, x+side, y+side)).(*image.RGBA)
+}
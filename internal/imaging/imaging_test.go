@@ -0,0 +1,286 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// tiffWithOrientation builds a TIFF header whose first IFD holds the
+// orientation tag alone.
+func tiffWithOrientation(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 8+2+12)
+
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], exifOrientationTag)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+
+	return tiff
+}
+
+// withExif inserts an APP1 segment carrying tiff right after the SOI marker of
+// a JPEG.
+func withExif(jpg, tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(2+len(segment)))
+	out = append(out, segment...)
+
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestTiffOrientation(t *testing.T) {
+	truncated := tiffWithOrientation(binary.BigEndian, 6)
+	truncated = truncated[:len(truncated)-4]
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"little endian", tiffWithOrientation(binary.LittleEndian, 6), 6},
+		{"big endian", tiffWithOrientation(binary.BigEndian, 8), 8},
+		{"out of range", tiffWithOrientation(binary.LittleEndian, 9), 1},
+		{"zero", tiffWithOrientation(binary.LittleEndian, 0), 1},
+		{"truncated entry", truncated, 1},
+		{"unknown byte order", append([]byte("XX"), tiffWithOrientation(binary.BigEndian, 6)[2:]...), 1},
+		{"too short", []byte("MM\x00*"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tiffOrientation(tt.tiff); got != tt.want {
+				t.Errorf("tiffOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJpegOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, 4, 2)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"without EXIF", jpg, 1},
+		{"with EXIF", withExif(jpg, tiffWithOrientation(binary.BigEndian, 3)), 3},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"truncated segment", withExif(jpg, tiffWithOrientation(binary.BigEndian, 3))[:12], 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// a b c
+	// d e f
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+
+	for i, p := range "abcdef" {
+		src.Set(i%3, i/3, color.RGBA{R: uint8(p), A: 255})
+	}
+
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+		{9, []string{"abc", "def"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(rune('0'+tt.orientation)), func(t *testing.T) {
+			dst := applyOrientation(src, tt.orientation)
+			b := dst.Bounds()
+
+			var got []string
+
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				var row []byte
+
+				for x := b.Min.X; x < b.Max.X; x++ {
+					row = append(row, dst.RGBAAt(x, y).R)
+				}
+
+				got = append(got, string(row))
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("applyOrientation(%d) = %q, want %q", tt.orientation, got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("applyOrientation(%d) = %q, want %q", tt.orientation, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		w, h, maxSize int
+		wantW, wantH  int
+	}{
+		{"smaller is kept", 300, 200, 400, 300, 200},
+		{"landscape", 1600, 900, 400, 400, 225},
+		{"portrait", 900, 1600, 400, 225, 400},
+		{"square", 1000, 1000, 150, 150, 150},
+		{"thin strip keeps a pixel", 4000, 1, 400, 400, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := fit(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), tt.maxSize).Bounds()
+
+			if b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("fit(%dx%d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.maxSize, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestProcess(t *testing.T) {
+	var transparent bytes.Buffer
+
+	if err := png.Encode(&transparent, image.NewRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+
+	variants := []VariantSpec{{Name: "thumb", MaxSize: 150, Square: true}, {Name: "small", MaxSize: 400}}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		maxPixels int
+		wantErr   error
+		// dimensions of the original, then of each variant
+		wantSizes   [][2]int
+		contentType string
+	}{
+		{
+			name:        "opaque image",
+			data:        encodeJPEG(t, 800, 200),
+			maxPixels:   800 * 200,
+			wantSizes:   [][2]int{{800, 200}, {150, 150}, {400, 100}},
+			contentType: "image/jpeg",
+		},
+		{
+			name:        "rotated by its EXIF orientation",
+			data:        withExif(encodeJPEG(t, 800, 200), tiffWithOrientation(binary.LittleEndian, 6)),
+			maxPixels:   800 * 200,
+			wantSizes:   [][2]int{{200, 800}, {150, 150}, {100, 400}},
+			contentType: "image/jpeg",
+		},
+		{
+			name:        "transparent image",
+			data:        transparent.Bytes(),
+			maxPixels:   600 * 300,
+			wantSizes:   [][2]int{{600, 300}, {150, 150}, {400, 200}},
+			contentType: "image/png",
+		},
+		{
+			name:      "more pixels than allowed",
+			data:      encodeJPEG(t, 800, 200),
+			maxPixels: 800*200 - 1,
+			wantErr:   ErrTooLarge,
+		},
+		{
+			name:    "not an image",
+			data:    []byte("plain text, not an image"),
+			wantErr: ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Process(tt.data, Options{MaxPixels: tt.maxPixels, Variants: variants})
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Process() err = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := [2]int{result.Width, result.Height}; got != tt.wantSizes[0] {
+				t.Errorf("original = %v, want %v", got, tt.wantSizes[0])
+			}
+
+			if len(result.Variants) != len(variants) {
+				t.Fatalf("got %d variants, want %d", len(result.Variants), len(variants))
+			}
+
+			for i, v := range result.Variants {
+				if got := [2]int{v.Width, v.Height}; got != tt.wantSizes[i+1] {
+					t.Errorf("%s = %v, want %v", v.Name, got, tt.wantSizes[i+1])
+				}
+
+				if v.ContentType != tt.contentType {
+					t.Errorf("%s content type = %q, want %q", v.Name, v.ContentType, tt.contentType)
+				}
+
+				cfg, _, err := image.DecodeConfig(bytes.NewReader(v.Data))
+
+				if err != nil || cfg.Width != v.Width || cfg.Height != v.Height {
+					t.Errorf("%s decodes to %dx%d (%v), want %dx%d", v.Name, cfg.Width, cfg.Height, err, v.Width, v.Height)
+				}
+			}
+
+			if result.Blurhash == "" {
+				t.Error("Blurhash is empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation reads the EXIF orientation (1-8) of a JPEG, defaulting to 1
+// when the file has none or it cannot be parsed.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+
+		// start of scan: no more metadata segments follow
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == exifOrientationTag {
+			o := int(order.Uint16(tiff[entry+8:]))
+
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation rotates and flips the pixels as described by the EXIF
+// orientation so the image no longer depends on that metadata.
+func applyOrientation(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+
+			si := src.PixOffset(b.Min.X+sx, b.Min.Y+sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+
+	return dst
+}
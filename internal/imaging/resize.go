@@ -0,0 +1,60 @@
+package imaging
+
+import "image"
+
+// fit scales img down so that neither side exceeds maxSize.
+func fit(img *image.RGBA, maxSize int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w <= maxSize && h <= maxSize {
+		return toRGBA(img)
+	}
+
+	if w >= h {
+		return resize(img, maxSize, max(1, h*maxSize/w))
+	}
+
+	return resize(img, max(1, w*maxSize/h), maxSize)
+}
+
+// resize downsamples with a box filter: every destination pixel averages the
+// source pixels it covers, which avoids the aliasing of nearest-neighbour.
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0 := y * sh / dh
+		y1 := max((y+1)*sh/dh, y0+1)
+
+		for x := 0; x < dw; x++ {
+			x0 := x * sw / dw
+			x1 := max((x+1)*sw/dw, x0+1)
+
+			var r, g, bl, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				row := src.PixOffset(b.Min.X+x0, b.Min.Y+sy)
+
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[row])
+					g += uint64(src.Pix[row+1])
+					bl += uint64(src.Pix[row+2])
+					a += uint64(src.Pix[row+3])
+					row += 4
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
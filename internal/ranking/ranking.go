@@ -0,0 +1,129 @@
+// Package ranking scores the candidate posts of the ranked home feed. Scores
+// only depend on their inputs, the current time included, so a ranking can
+// be reproduced exactly.
+package ranking
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// Sources of candidates.
+const (
+	SourceFollowed = "followed"
+	SourceTag      = "tag"
+	SourceNetwork  = "network"
+)
+
+// Candidate is a post that may be shown in the ranked feed, with the signals
+// it is scored on.
+type Candidate struct {
+	PostID   int64
+	AuthorID int64
+	At       time.Time
+	// Source is how the post reached the viewer: an account they follow, a
+	// tag they follow or an account followed by the accounts they follow.
+	Source    string
+	Comments  int
+	Reposts   int
+	Bookmarks int
+	Votes     int
+	// Interactions counts the recent comments, reposts and bookmarks of the
+	// viewer on posts of the author.
+	Interactions int
+}
+
+type Weights struct {
+	// HalfLife is the age at which the recency of a post is halved.
+	HalfLife time.Duration
+	Comment  float64
+	Repost   float64
+	Bookmark float64
+	Vote     float64
+	// Engagement and Affinity scale the log of the weighted engagement and of
+	// the interactions with the author.
+	Engagement float64
+	Affinity   float64
+	// Sources multiplies the score of a post by how it reached the viewer.
+	Sources map[string]float64
+}
+
+var DefaultWeights = Weights{
+	HalfLife:   6 * time.Hour,
+	Comment:    2,
+	Repost:     3,
+	Bookmark:   1,
+	Vote:       0.5,
+	Engagement: 1,
+	Affinity:   1.5,
+	Sources: map[string]float64{
+		SourceFollowed: 1,
+		SourceTag:      0.8,
+		SourceNetwork:  0.5,
+	},
+}
+
+// Explanation breaks a score down into its factors:
+// Score = Recency * (1 + Engagement + Affinity) * Source.
+type Explanation struct {
+	Recency    float64 `json:"recency"`
+	Engagement float64 `json:"engagement"`
+	Affinity   float64 `json:"affinity"`
+	Source     float64 `json:"source"`
+	Score      float64 `json:"score"`
+}
+
+type Scored struct {
+	Candidate
+	Explanation
+}
+
+// Score computes the score of a candidate at now. Posts from the future are
+// treated as just published.
+func Score(c Candidate, now time.Time, w Weights) Explanation {
+	age := max(now.Sub(c.At), 0)
+
+	e := Explanation{
+		Recency: math.Exp2(-age.Hours() / w.HalfLife.Hours()),
+		Engagement: w.Engagement * math.Log1p(
+			w.Comment*float64(c.Comments)+
+				w.Repost*float64(c.Reposts)+
+				w.Bookmark*float64(c.Bookmarks)+
+				w.Vote*float64(c.Votes)),
+		Affinity: w.Affinity * math.Log1p(float64(c.Interactions)),
+		Source:   w.Sources[c.Source],
+	}
+
+	e.Score = e.Recency * (1 + e.Engagement + e.Affinity) * e.Source
+
+	return e
+}
+
+// Rank scores the candidates and sorts them best first. Equal scores are
+// ordered by the highest post ID, so that a position in the ranking is given
+// by a score and a post ID.
+func Rank(candidates []Candidate, now time.Time, w Weights) []Scored {
+	ranked := make([]Scored, len(candidates))
+
+	for i, c := range candidates {
+		ranked[i] = Scored{Candidate: c, Explanation: Score(c, now, w)}
+	}
+
+	slices.SortFunc(ranked, func(a, b Scored) int {
+		return Compare(a, b.Score, b.PostID)
+	})
+
+	return ranked
+}
+
+// Compare orders s against the position of a post with the given score and
+// ID in the order of Rank: it is negative when s ranks before it.
+func Compare(s Scored, score float64, postID int64) int {
+	if c := cmp.Compare(score, s.Score); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(postID, s.PostID)
+}
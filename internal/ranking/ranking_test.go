@@ -0,0 +1,169 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestScore(t *testing.T) {
+	w := DefaultWeights
+
+	tests := []struct {
+		name      string
+		candidate Candidate
+		want      Explanation
+	}{
+		{
+			name:      "just published without engagement",
+			candidate: Candidate{At: now, Source: SourceFollowed},
+			want:      Explanation{Recency: 1, Source: 1, Score: 1},
+		},
+		{
+			name:      "one half-life old",
+			candidate: Candidate{At: now.Add(-w.HalfLife), Source: SourceFollowed},
+			want:      Explanation{Recency: 0.5, Source: 1, Score: 0.5},
+		},
+		{
+			name:      "two half-lives old",
+			candidate: Candidate{At: now.Add(-2 * w.HalfLife), Source: SourceFollowed},
+			want:      Explanation{Recency: 0.25, Source: 1, Score: 0.25},
+		},
+		{
+			name:      "from the future",
+			candidate: Candidate{At: now.Add(time.Hour), Source: SourceFollowed},
+			want:      Explanation{Recency: 1, Source: 1, Score: 1},
+		},
+		{
+			name:      "weighted engagement",
+			candidate: Candidate{At: now, Source: SourceFollowed, Comments: 1, Reposts: 1, Bookmarks: 1, Votes: 2},
+			// 2*1 + 3*1 + 1*1 + 0.5*2 = 7
+			want: Explanation{Recency: 1, Engagement: math.Log1p(7), Source: 1, Score: 1 + math.Log1p(7)},
+		},
+		{
+			name:      "affinity with the author",
+			candidate: Candidate{At: now, Source: SourceFollowed, Interactions: 3},
+			want:      Explanation{Recency: 1, Affinity: 1.5 * math.Log1p(3), Source: 1, Score: 1 + 1.5*math.Log1p(3)},
+		},
+		{
+			name:      "network source",
+			candidate: Candidate{At: now.Add(-w.HalfLife), Source: SourceNetwork, Comments: 1},
+			want:      Explanation{Recency: 0.5, Engagement: math.Log1p(2), Source: 0.5, Score: 0.5 * (1 + math.Log1p(2)) * 0.5},
+		},
+		{
+			name:      "unknown source",
+			candidate: Candidate{At: now, Source: "other", Comments: 10},
+			want:      Explanation{Recency: 1, Engagement: math.Log1p(20), Source: 0, Score: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.candidate, now, w)
+
+			if !approx(got.Recency, tt.want.Recency) || !approx(got.Engagement, tt.want.Engagement) ||
+				!approx(got.Affinity, tt.want.Affinity) || !approx(got.Source, tt.want.Source) || !approx(got.Score, tt.want.Score) {
+				t.Errorf("Score() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []Candidate
+		want       []int64
+	}{
+		{
+			name: "recent posts first",
+			candidates: []Candidate{
+				{PostID: 1, At: now.Add(-12 * time.Hour), Source: SourceFollowed},
+				{PostID: 2, At: now, Source: SourceFollowed},
+				{PostID: 3, At: now.Add(-time.Hour), Source: SourceFollowed},
+			},
+			want: []int64{2, 3, 1},
+		},
+		{
+			name: "engagement outweighs a little age",
+			candidates: []Candidate{
+				{PostID: 1, At: now, Source: SourceFollowed},
+				{PostID: 2, At: now.Add(-time.Hour), Source: SourceFollowed, Reposts: 10},
+			},
+			want: []int64{2, 1},
+		},
+		{
+			name: "affinity outweighs a little age",
+			candidates: []Candidate{
+				{PostID: 1, At: now, Source: SourceFollowed},
+				{PostID: 2, At: now.Add(-time.Hour), Source: SourceFollowed, Interactions: 5},
+			},
+			want: []int64{2, 1},
+		},
+		{
+			name: "followed accounts before the network",
+			candidates: []Candidate{
+				{PostID: 1, At: now, Source: SourceNetwork},
+				{PostID: 2, At: now, Source: SourceTag},
+				{PostID: 3, At: now, Source: SourceFollowed},
+			},
+			want: []int64{3, 2, 1},
+		},
+		{
+			name: "equal scores by highest post ID",
+			candidates: []Candidate{
+				{PostID: 4, At: now, Source: SourceFollowed},
+				{PostID: 9, At: now, Source: SourceFollowed},
+				{PostID: 7, At: now, Source: SourceFollowed},
+			},
+			want: []int64{9, 7, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked := Rank(tt.candidates, now, DefaultWeights)
+
+			if len(ranked) != len(tt.want) {
+				t.Fatalf("Rank() returned %d posts, want %d", len(ranked), len(tt.want))
+			}
+
+			for i, s := range ranked {
+				if s.PostID != tt.want[i] {
+					t.Fatalf("Rank()[%d] = post %d, want post %d", i, s.PostID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	s := Scored{Candidate: Candidate{PostID: 5}, Explanation: Explanation{Score: 2}}
+
+	tests := []struct {
+		name   string
+		score  float64
+		postID int64
+		want   int
+	}{
+		{"lower score", 1, 5, -1},
+		{"higher score", 3, 5, 1},
+		{"same score, lower ID", 2, 4, -1},
+		{"same score, higher ID", 2, 6, 1},
+		{"same position", 2, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(s, tt.score, tt.postID); got != tt.want {
+				t.Errorf("Compare(%v, %d) = %d, want %d", tt.score, tt.postID, got, tt.want)
+			}
+		})
+	}
+}
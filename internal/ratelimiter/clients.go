@@ -0,0 +1,89 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// maxClients bounds the number of clients a local limiter tracks, so that
+// scanning traffic from many addresses cannot exhaust memory.
+const maxClients = 100_000
+
+// clients holds the state of each client of a local limiter, most recently
+// seen first. A single janitor goroutine, running for the lifetime of the
+// limiter, drops the states that expired, that is which a new client would
+// start with anyway.
+type clients[S any] struct {
+	sync.Mutex
+	capacity int
+	order    *list.List
+	states   map[string]*list.Element
+	expired  func(s *S, now time.Time) bool
+}
+
+type clientState[S any] struct {
+	ip    string
+	state S
+}
+
+func newClients[S any](sweepInterval time.Duration, expired func(s *S, now time.Time) bool) *clients[S] {
+	c := &clients[S]{
+		capacity: maxClients,
+		order:    list.New(),
+		states:   make(map[string]*list.Element),
+		expired:  expired,
+	}
+
+	go c.janitor(sweepInterval)
+
+	return c
+}
+
+// get returns the state of the client, adding a zero state for a new one.
+// When full, the client seen least recently is forgotten to make room: the
+// clients sending requests keep their state. It must be called with the lock
+// held.
+func (c *clients[S]) get(ip string) *S {
+	if el, ok := c.states[ip]; ok {
+		c.order.MoveToFront(el)
+		return &el.Value.(*clientState[S]).state
+	}
+
+	if len(c.states) >= c.capacity {
+		if oldest := c.order.Back(); oldest != nil {
+			c.remove(oldest)
+		}
+	}
+
+	cs := &clientState[S]{ip: ip}
+	c.states[ip] = c.order.PushFront(cs)
+
+	return &cs.state
+}
+
+func (c *clients[S]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.states, el.Value.(*clientState[S]).ip)
+}
+
+func (c *clients[S]) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		c.Lock()
+
+		for el := c.order.Front(); el != nil; {
+			next := el.Next()
+
+			if c.expired(&el.Value.(*clientState[S]).state, now) {
+				c.remove(el)
+			}
+
+			el = next
+		}
+
+		c.Unlock()
+	}
+}
@@ -21,23 +21,21 @@ func NewFixedWindowRateLimiter(limit int, window time.Duration) *FixedWindowRate
 }
 
 func (r *FixedWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
-	r.RLock()
-	count, exists := r.clients[ip]
-	r.Unlock()
+	r.Lock()
+	defer r.Unlock()
 
-	if !exists || count < r.limit {
-		r.Lock()
+	count, exists := r.clients[ip]
 
-		if !exists {
-			go r.resetCount(ip)
-		}
+	if !exists {
+		go r.resetCount(ip)
+	}
 
-		r.clients[ip]++
-		r.Unlock()
-		return true, 0
+	if count >= r.limit {
+		return false, r.window
 	}
 
-	return false, r.window
+	r.clients[ip]++
+	return true, 0
 }
 
 func (r *FixedWindowRateLimiter) resetCount(ip string) {
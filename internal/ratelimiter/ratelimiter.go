@@ -8,6 +8,15 @@ type Limiter interface {
 
 type Config struct {
 	RequestsPerTimeFrame int
-	TimeFrame            time.Duration
-	Enabled              bool
+	// AnonymousRequestsPerTimeFrame is the lower limit applied to visitors
+	// browsing public routes without a token.
+	AnonymousRequestsPerTimeFrame int
+	TimeFrame                     time.Duration
+	Enabled                       bool
+	// Algorithm is the one counting requests locally: "fixed-window",
+	// "sliding-window" or "token-bucket".
+	Algorithm string
+	// Backend is "redis" to share the limits across instances, when redis
+	// is enabled, or "local" to count per instance.
+	Backend string
 }
@@ -0,0 +1,307 @@
+package ratelimiter
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var windowStart = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestSlidingWindowRetryAfter(t *testing.T) {
+	r := NewSlidingWindowRateLimiter(10, time.Minute)
+
+	tests := []struct {
+		name     string
+		previous int
+		current  int
+		elapsed  time.Duration
+		want     time.Duration
+	}{
+		{
+			name:     "previous window fades within this one",
+			previous: 20, current: 5, elapsed: 15 * time.Second,
+			// 20 * (1 - t/60s) + 5 < 10 past t = 45s
+			want: 30*time.Second + 1,
+		},
+		{
+			name:     "previous window just at the limit",
+			previous: 10, current: 5, elapsed: 30 * time.Second,
+			want: 1,
+		},
+		{
+			name:     "current window full, next one starts clear",
+			previous: 0, current: 10, elapsed: 20 * time.Second,
+			want: 40*time.Second + 1,
+		},
+		{
+			name:     "current window over, fading into the next one",
+			previous: 5, current: 20, elapsed: 20 * time.Second,
+			// 20 * (1 - t/60s) < 10 past t = 30s into the next window
+			want: 70*time.Second + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &windowCount{previous: tt.previous, current: tt.current}
+
+			if got := r.retryAfter(c, tt.elapsed); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSlidingWindowRetryAfterAllows checks that a denied client is let
+// through once it waited retryAfter, and not a nanosecond earlier.
+func TestSlidingWindowRetryAfterAllows(t *testing.T) {
+	tests := []struct {
+		name string
+		// requests sent, and when, before the client gets denied
+		sent []time.Duration
+	}{
+		{"burst at the start of a window", []time.Duration{0}},
+		{"burst late in a window", []time.Duration{50 * time.Second}},
+		{"bursts in consecutive windows", []time.Duration{10 * time.Second, 70 * time.Second}},
+		{"burst after an idle window", []time.Duration{5 * time.Second, 130 * time.Second}},
+		{"uneven window", []time.Duration{7*time.Second + 333*time.Millisecond, 61*time.Second + 17}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := windowStart
+			r := NewSlidingWindowRateLimiter(7, time.Minute)
+			r.now = func() time.Time { return now }
+
+			var retryAfter time.Duration
+
+			for _, at := range tt.sent {
+				now = windowStart.Add(at)
+
+				for i := 0; ; i++ {
+					allowed, wait := r.Allow("client")
+
+					if !allowed {
+						retryAfter = wait
+						break
+					}
+
+					if i > 100 {
+						t.Fatal("client never denied")
+					}
+				}
+			}
+
+			if retryAfter <= 0 {
+				t.Fatalf("retryAfter = %v, want it positive", retryAfter)
+			}
+
+			deniedAt := now
+
+			now = deniedAt.Add(retryAfter - 1)
+
+			if allowed, _ := r.Allow("client"); allowed {
+				t.Fatalf("allowed %v after being denied, before retryAfter = %v", retryAfter-1, retryAfter)
+			}
+
+			now = deniedAt.Add(retryAfter)
+
+			if allowed, wait := r.Allow("client"); !allowed {
+				t.Fatalf("denied after waiting retryAfter = %v, told to wait %v more", retryAfter, wait)
+			}
+		})
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	// 8 requests every 8s: a token comes back every second, in steps exact
+	// in floating point
+	const limit = 8
+
+	type step struct {
+		after   time.Duration
+		allowed bool
+		wait    time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		burst int
+		steps []step
+	}{
+		{
+			name:  "burst up to the limit",
+			burst: limit,
+			steps: []step{{after: 0, allowed: false, wait: time.Second}},
+		},
+		{
+			name:  "partial refill",
+			burst: limit,
+			steps: []step{{after: 250 * time.Millisecond, allowed: false, wait: 750 * time.Millisecond}},
+		},
+		{
+			name:  "one token back after the refill time",
+			burst: limit,
+			steps: []step{
+				{after: time.Second, allowed: true},
+				{after: 0, allowed: false, wait: time.Second},
+			},
+		},
+		{
+			name:  "refill capped at the limit",
+			burst: limit,
+			steps: []step{
+				{after: time.Hour, allowed: true},
+				{after: 0, allowed: true},
+			},
+		},
+		{
+			name:  "tokens left after a partial burst",
+			burst: 4,
+			steps: []step{
+				{after: 0, allowed: true},
+				{after: 0, allowed: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := windowStart
+			r := NewTokenBucketRateLimiter(limit, 8*time.Second)
+			r.now = func() time.Time { return now }
+
+			for i := 0; i < tt.burst; i++ {
+				if allowed, _ := r.Allow("client"); !allowed {
+					t.Fatalf("request %d of the burst denied", i+1)
+				}
+			}
+
+			for i, s := range tt.steps {
+				now = now.Add(s.after)
+
+				allowed, wait := r.Allow("client")
+
+				if allowed != s.allowed || wait != s.wait {
+					t.Fatalf("step %d: Allow() = %v, %v, want %v, %v", i, allowed, wait, s.allowed, s.wait)
+				}
+			}
+		})
+	}
+}
+
+// TestTokenBucketRetryAfterAllows checks that a denied client is let through
+// once it waited retryAfter, and not a nanosecond earlier.
+func TestTokenBucketRetryAfterAllows(t *testing.T) {
+	now := windowStart
+	r := NewTokenBucketRateLimiter(7, time.Minute)
+	r.now = func() time.Time { return now }
+
+	for _, at := range []time.Duration{0, 3*time.Second + 17, 11 * time.Second, 11*time.Second + 1} {
+		now = windowStart.Add(at)
+
+		var retryAfter time.Duration
+
+		for {
+			allowed, wait := r.Allow("client")
+
+			if !allowed {
+				retryAfter = wait
+				break
+			}
+		}
+
+		deniedAt := now
+
+		now = deniedAt.Add(retryAfter - 1)
+
+		if allowed, _ := r.Allow("client"); allowed {
+			t.Fatalf("at %v: allowed before retryAfter = %v", at, retryAfter)
+		}
+
+		now = deniedAt.Add(retryAfter)
+
+		if allowed, wait := r.Allow("client"); !allowed {
+			t.Fatalf("at %v: denied after waiting retryAfter = %v, told to wait %v more", at, retryAfter, wait)
+		}
+	}
+}
+
+func TestClientsEvictLeastRecentlySeen(t *testing.T) {
+	c := newClients(time.Hour, func(*int, time.Time) bool { return false })
+	c.capacity = 2
+
+	c.Lock()
+	defer c.Unlock()
+
+	*c.get("a") = 1
+	*c.get("b") = 2
+
+	// a is seen again, so b is the one forgotten
+	c.get("a")
+	*c.get("c") = 3
+
+	if _, ok := c.states["b"]; ok {
+		t.Fatal("b was kept, want it evicted")
+	}
+
+	if got := *c.get("a"); got != 1 {
+		t.Errorf("a = %d, want its state kept", got)
+	}
+
+	if got := *c.get("c"); got != 3 {
+		t.Errorf("c = %d, want its state kept", got)
+	}
+}
+
+// benchmarkKeys are the clients of the many-key benchmarks.
+var benchmarkKeys = func() []string {
+	keys := make([]string, 10_000)
+
+	for i := range keys {
+		keys[i] = "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)
+	}
+
+	return keys
+}()
+
+func benchmarkLimiter(b *testing.B, newLimiter func() Limiter) {
+	b.Run("single key", func(b *testing.B) {
+		l := newLimiter()
+
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				l.Allow("10.0.0.1")
+			}
+		})
+	})
+
+	b.Run("many keys", func(b *testing.B) {
+		l := newLimiter()
+
+		var next atomic.Int64
+
+		b.RunParallel(func(pb *testing.PB) {
+			i := int(next.Add(1)) * 7919
+
+			for pb.Next() {
+				l.Allow(benchmarkKeys[i%len(benchmarkKeys)])
+				i++
+			}
+		})
+	})
+}
+
+func BenchmarkFixedWindow(b *testing.B) {
+	benchmarkLimiter(b, func() Limiter { return NewFixedWindowRateLimiter(100, time.Minute) })
+}
+
+func BenchmarkSlidingWindow(b *testing.B) {
+	benchmarkLimiter(b, func() Limiter { return NewSlidingWindowRateLimiter(100, time.Minute) })
+}
+
+func BenchmarkTokenBucket(b *testing.B) {
+	benchmarkLimiter(b, func() Limiter { return NewTokenBucketRateLimiter(100, time.Minute) })
+}
@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	// redisTimeout bounds the latency the limiter adds to a request.
+	redisTimeout = 100 * time.Millisecond
+	// redisCooldown is how long the fallback is used after redis failed,
+	// before redis is tried again.
+	redisCooldown = 5 * time.Second
+)
+
+// slidingLogScript keeps, in a sorted set, the requests allowed within the
+// last window, scored by the time they came in, in microseconds of the redis
+// clock. A request is allowed while fewer than limit are logged: no window
+// ever holds more. Denied requests are not logged. It returns {1, 0} when
+// allowed, {0, retry after in microseconds} otherwise, the time until the
+// oldest request logged leaves the window.
+var slidingLogScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) >= limit then
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	return {0, tonumber(oldest[2]) + window - now}
+end
+redis.call('ZADD', KEYS[1], now, ARGV[3])
+redis.call('PEXPIRE', KEYS[1], math.ceil(window / 1000))
+return {1, 0}
+`)
+
+// RedisLimiter allows limit requests per window and client across every API
+// instance, over any window: the requests of the last window are logged, so
+// a burst at the end of one window does not add to one at the start of the
+// next. When redis cannot be reached, it falls back to a limiter local to
+// the instance.
+type RedisLimiter struct {
+	rdb      *redis.Client
+	prefix   string
+	limit    int
+	window   time.Duration
+	fallback Limiter
+	// downUntil is the UnixNano time until which the fallback is used.
+	downUntil atomic.Int64
+}
+
+// NewRedisLimiter counts the requests under keys namespaced by prefix, which
+// keeps limiters sharing a redis apart.
+func NewRedisLimiter(rdb *redis.Client, prefix string, limit int, window time.Duration, fallback Limiter) *RedisLimiter {
+	return &RedisLimiter{
+		rdb:      rdb,
+		prefix:   prefix,
+		limit:    max(limit, 1),
+		window:   window,
+		fallback: fallback,
+	}
+}
+
+func (r *RedisLimiter) Allow(ip string) (bool, time.Duration) {
+	if time.Now().UnixNano() < r.downUntil.Load() {
+		return r.fallback.Allow(ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key := fmt.Sprintf("ratelimit:%s:%s", r.prefix, ip)
+
+	// requests logged in the same microsecond are told apart by their ID
+	res, err := slidingLogScript.Run(ctx, r.rdb, []string{key}, r.window.Microseconds(), r.limit, uuid.NewString()).Int64Slice()
+
+	if err != nil {
+		r.downUntil.Store(time.Now().Add(redisCooldown).UnixNano())
+		return r.fallback.Allow(ip)
+	}
+
+	if res[0] == 0 {
+		return false, time.Duration(res[1]) * time.Microsecond
+	}
+
+	return true, 0
+}
@@ -0,0 +1,86 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+)
+
+// SlidingWindowRateLimiter counts requests per fixed window like
+// FixedWindowRateLimiter, but weighs in the count of the previous window by
+// how much of it still overlaps the last window duration. This smooths out
+// the double bursts allowed around window edges.
+type SlidingWindowRateLimiter struct {
+	clients *clients[windowCount]
+	limit   int
+	window  time.Duration
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type windowCount struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+func NewSlidingWindowRateLimiter(limit int, window time.Duration) *SlidingWindowRateLimiter {
+	return &SlidingWindowRateLimiter{
+		// once two windows went by, nothing of the counts is left
+		clients: newClients(window, func(c *windowCount, now time.Time) bool {
+			return now.Sub(c.start) >= 2*window
+		}),
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+func (r *SlidingWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
+	r.clients.Lock()
+	defer r.clients.Unlock()
+
+	now := r.now()
+	start := now.Truncate(r.window)
+	c := r.clients.get(ip)
+
+	switch {
+	case start.Sub(c.start) == r.window:
+		c.previous, c.current = c.current, 0
+	case !start.Equal(c.start):
+		c.previous, c.current = 0, 0
+	}
+
+	c.start = start
+
+	elapsed := now.Sub(start)
+	overlap := 1 - float64(elapsed)/float64(r.window)
+
+	if float64(c.previous)*overlap+float64(c.current) < float64(r.limit) {
+		c.current++
+		return true, 0
+	}
+
+	return false, r.retryAfter(c, elapsed)
+}
+
+// retryAfter is how long until the weighted count of a denied client falls
+// under the limit. At the time computed, it is exactly at the limit: the
+// client is told to retry the nanosecond after.
+func (r *SlidingWindowRateLimiter) retryAfter(c *windowCount, elapsed time.Duration) time.Duration {
+	window := float64(r.window)
+
+	// within this window, the previous count has to fade enough
+	if c.current < r.limit {
+		at := window * (1 - float64(r.limit-c.current)/float64(c.previous))
+		return time.Duration(math.Floor(at)) + 1 - elapsed
+	}
+
+	// otherwise the current count becomes the previous one and has to fade
+	if c.current == 0 {
+		return r.window - elapsed
+	}
+
+	at := window * (1 - float64(r.limit)/float64(c.current))
+
+	return r.window - elapsed + time.Duration(math.Floor(at)) + 1
+}
@@ -0,0 +1,63 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucketRateLimiter gives each client a bucket of limit tokens, refilled
+// at limit tokens per window. Every request takes a token, so clients can
+// burst up to limit requests and then sustain the refill rate.
+type TokenBucketRateLimiter struct {
+	clients  *clients[bucket]
+	capacity float64
+	// refill is the time it takes to get a token back.
+	refill time.Duration
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucketRateLimiter(limit int, window time.Duration) *TokenBucketRateLimiter {
+	capacity := float64(max(limit, 1))
+	refill := time.Duration(float64(window) / capacity)
+
+	return &TokenBucketRateLimiter{
+		// a bucket refilled to capacity is the one a new client gets
+		clients: newClients(window, func(b *bucket, now time.Time) bool {
+			return float64(now.Sub(b.last)) >= (capacity-b.tokens)*float64(refill)
+		}),
+		capacity: capacity,
+		refill:   refill,
+		now:      time.Now,
+	}
+}
+
+func (r *TokenBucketRateLimiter) Allow(ip string) (bool, time.Duration) {
+	r.clients.Lock()
+	defer r.clients.Unlock()
+
+	now := r.now()
+	b := r.clients.get(ip)
+
+	if b.last.IsZero() {
+		b.tokens = r.capacity
+	} else {
+		b.tokens = min(r.capacity, b.tokens+float64(now.Sub(b.last))/float64(r.refill))
+	}
+
+	b.last = now
+
+	// rounded up, so that the token is back once the client waited
+	if b.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - b.tokens) * float64(r.refill)))
+	}
+
+	b.tokens--
+
+	return true, 0
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"html"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MemoryIndex is an Index held in memory, for tests and local development. A
+// document matches when it contains every word of the query; title matches
+// weigh twice as much as content ones. Query operators are not supported.
+type MemoryIndex struct {
+	mu   sync.RWMutex
+	docs map[int64]memoryDocument
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type memoryDocument struct {
+	Document
+	indexedAt time.Time
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{docs: make(map[int64]memoryDocument), now: time.Now}
+}
+
+func (x *MemoryIndex) Upsert(ctx context.Context, docs []Document) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	now := x.now()
+
+	for _, d := range docs {
+		if found, ok := x.docs[d.PostID]; ok && found.Version > d.Version {
+			continue
+		}
+
+		x.docs[d.PostID] = memoryDocument{Document: d, indexedAt: now}
+	}
+
+	return nil
+}
+
+func (x *MemoryIndex) Delete(ctx context.Context, postIDs []int64) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, id := range postIDs {
+		delete(x.docs, id)
+	}
+
+	return nil
+}
+
+func (x *MemoryIndex) Prune(ctx context.Context, before time.Time) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for id, d := range x.docs {
+		if d.indexedAt.Before(before) {
+			delete(x.docs, id)
+		}
+	}
+
+	return nil
+}
+
+func (x *MemoryIndex) Search(ctx context.Context, q Query) ([]Hit, error) {
+	terms := words(q.Text)
+
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var hits []Hit
+
+	for _, d := range x.docs {
+		title, content := count(words(d.Title)), count(words(d.Content))
+
+		rank := 0.0
+		matched := true
+
+		for _, t := range terms {
+			if title[t] == 0 && content[t] == 0 {
+				matched = false
+				break
+			}
+
+			rank += float64(2*title[t] + content[t])
+		}
+
+		if !matched {
+			continue
+		}
+
+		hit := Hit{PostID: d.PostID, Rank: rank, Snippet: mark(d.Content, terms), Title: mark(d.Title, terms)}
+
+		if q.After != nil && !follows(hit, *q.After, q.Before) {
+			continue
+		}
+
+		hits = append(hits, hit)
+	}
+
+	slices.SortFunc(hits, func(a, b Hit) int {
+		c := cmp.Compare(b.Rank, a.Rank)
+
+		if c == 0 {
+			c = cmp.Compare(b.PostID, a.PostID)
+		}
+
+		if q.Before {
+			c = -c
+		}
+
+		return c
+	})
+
+	if len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+
+	return hits, nil
+}
+
+// words splits text into lowercase words.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func count(words []string) map[string]int {
+	counts := make(map[string]int, len(words))
+
+	for _, w := range words {
+		counts[w]++
+	}
+
+	return counts
+}
+
+// mark escapes the text and wraps the words of the query it contains in
+// <mark> tags.
+func mark(content string, terms []string) string {
+	var b strings.Builder
+
+	start := -1
+
+	flush := func(end int) {
+		word := content[start:end]
+
+		if slices.Contains(terms, strings.ToLower(word)) {
+			b.WriteString("<mark>" + html.EscapeString(word) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+
+		start = -1
+	}
+
+	for i, r := range content {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			flush(i)
+		}
+
+		if !inWord {
+			b.WriteString(html.EscapeString(string(r)))
+		}
+	}
+
+	if start >= 0 {
+		flush(len(content))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,206 @@
+package search
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestIndex(t *testing.T, docs ...Document) *MemoryIndex {
+	t.Helper()
+
+	x := NewMemoryIndex()
+
+	if err := x.Upsert(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+
+	return x
+}
+
+func hitIDs(hits []Hit) []int64 {
+	ids := make([]int64, len(hits))
+
+	for i, h := range hits {
+		ids[i] = h.PostID
+	}
+
+	return ids
+}
+
+func TestMemoryIndexSearch(t *testing.T) {
+	x := newTestIndex(t,
+		Document{PostID: 1, Title: "Go tips", Content: "small tips about go"},
+		Document{PostID: 2, Title: "Rust", Content: "go and rust compared"},
+		Document{PostID: 3, Title: "Cooking", Content: "pasta recipes"},
+		Document{PostID: 4, Title: "Rust", Content: "rust and go compared"},
+	)
+
+	tests := []struct {
+		name string
+		text string
+		want []int64
+	}{
+		{"title matches weigh more", "go", []int64{1, 4, 2}},
+		{"every word must match", "go rust", []int64{4, 2}},
+		{"case insensitive", "PASTA", []int64{3}},
+		{"no match", "java", nil},
+		{"empty query", "  ", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := x.Search(context.Background(), Query{Text: tt.text, Limit: 10})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := hitIDs(hits); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexSearchPages(t *testing.T) {
+	x := newTestIndex(t,
+		Document{PostID: 1, Content: "go"},
+		Document{PostID: 2, Content: "go go"},
+		Document{PostID: 3, Content: "go"},
+		Document{PostID: 4, Content: "go go go"},
+	)
+
+	ctx := context.Background()
+
+	first, err := x.Search(ctx, Query{Text: "go", Limit: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hitIDs(first), []int64{4, 2}; !slices.Equal(got, want) {
+		t.Fatalf("first page = %v, want %v", got, want)
+	}
+
+	second, err := x.Search(ctx, Query{Text: "go", Limit: 2, After: &first[1]})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hitIDs(second), []int64{3, 1}; !slices.Equal(got, want) {
+		t.Fatalf("second page = %v, want %v", got, want)
+	}
+
+	back, err := x.Search(ctx, Query{Text: "go", Limit: 2, After: &second[0], Before: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hitIDs(back), []int64{2, 4}; !slices.Equal(got, want) {
+		t.Fatalf("previous page = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryIndexHighlight(t *testing.T) {
+	x := newTestIndex(t, Document{PostID: 1, Title: "Go <b>tips</b>", Content: "go & more"})
+
+	hits, err := x.Search(context.Background(), Query{Text: "go", Limit: 1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(hits))
+	}
+
+	if want := "<mark>Go</mark> &lt;b&gt;tips&lt;/b&gt;"; hits[0].Title != want {
+		t.Errorf("Title = %q, want %q", hits[0].Title, want)
+	}
+
+	if want := "<mark>go</mark> &amp; more"; hits[0].Snippet != want {
+		t.Errorf("Snippet = %q, want %q", hits[0].Snippet, want)
+	}
+}
+
+func TestMemoryIndexUpsertVersions(t *testing.T) {
+	x := newTestIndex(t, Document{PostID: 1, Content: "second draft", Version: 2})
+
+	ctx := context.Background()
+
+	// an outbox entry applied late
+	if err := x.Upsert(ctx, []Document{{PostID: 1, Content: "first draft", Version: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits, _ := x.Search(ctx, Query{Text: "first", Limit: 10}); len(hits) != 0 {
+		t.Fatalf("older version replaced the document")
+	}
+
+	if err := x.Upsert(ctx, []Document{{PostID: 1, Content: "third draft", Version: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits, _ := x.Search(ctx, Query{Text: "third", Limit: 10}); len(hits) != 1 {
+		t.Fatalf("newer version did not replace the document")
+	}
+}
+
+func TestMemoryIndexPrune(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	x := NewMemoryIndex()
+	x.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	if err := x.Upsert(ctx, []Document{{PostID: 1, Content: "go"}, {PostID: 2, Content: "go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := now.Add(time.Minute)
+	now = start
+
+	// the rebuild only finds post 2
+	if err := x.Upsert(ctx, []Document{{PostID: 2, Content: "go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := x.Prune(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := x.Search(ctx, Query{Text: "go", Limit: 10})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hitIDs(hits), []int64{2}; !slices.Equal(got, want) {
+		t.Errorf("after Prune = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryIndexDelete(t *testing.T) {
+	x := newTestIndex(t, Document{PostID: 1, Content: "go"}, Document{PostID: 2, Content: "go"})
+
+	ctx := context.Background()
+
+	if err := x.Delete(ctx, []int64{1, 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := x.Search(ctx, Query{Text: "go", Limit: 10})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := hitIDs(hits), []int64{2}; !slices.Equal(got, want) {
+		t.Errorf("after Delete = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const queryTimeout = 5 * time.Second
+
+// HeadlineOptions are the ts_headline options of the snippets, to be passed
+// through Highlight. Matches are delimited by control characters, replaced by
+// <mark> tags once the text around them is escaped.
+const HeadlineOptions = "StartSel=\x02, StopSel=\x03, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// TitleHeadlineOptions mark the matches like HeadlineOptions, but keep the
+// whole text: titles are short.
+const TitleHeadlineOptions = "StartSel=\x02, StopSel=\x03, HighlightAll=true"
+
+// PostgresIndex keeps the documents in the search_documents table, searched
+// with the social text search configuration.
+type PostgresIndex struct {
+	db *sql.DB
+}
+
+func NewPostgresIndex(db *sql.DB) *PostgresIndex {
+	return &PostgresIndex{db: db}
+}
+
+// Upsert skips the documents older than the ones indexed, so that outbox
+// entries may be applied out of order.
+func (x *PostgresIndex) Upsert(ctx context.Context, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO search_documents (post_id, user_id, title, content, tags, published_at, version)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (post_id) DO UPDATE
+	SET user_id = EXCLUDED.user_id, title = EXCLUDED.title, content = EXCLUDED.content,
+		tags = EXCLUDED.tags, published_at = EXCLUDED.published_at, version = EXCLUDED.version,
+		indexed_at = NOW()
+	WHERE EXCLUDED.version >= search_documents.version`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := x.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, d := range docs {
+		tags := d.Tags
+
+		if tags == nil {
+			tags = []string{}
+		}
+
+		if _, err := stmt.ExecContext(ctx, d.PostID, d.UserID, d.Title, d.Content, pq.Array(tags), d.PublishedAt, d.Version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (x *PostgresIndex) Delete(ctx context.Context, postIDs []int64) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := x.db.ExecContext(ctx, `DELETE FROM search_documents WHERE post_id = ANY($1)`, pq.Array(postIDs))
+
+	return err
+}
+
+func (x *PostgresIndex) Search(ctx context.Context, q Query) ([]Hit, error) {
+	op, dir := "<", "DESC"
+
+	if q.Before {
+		op, dir = ">", "ASC"
+	}
+
+	var afterRank, afterID any
+
+	if q.After != nil {
+		afterRank, afterID = q.After.Rank, q.After.PostID
+	}
+
+	query := `
+	SELECT h.post_id, h.rank, ts_headline('social', h.content, h.query, '` + HeadlineOptions + `'),
+		ts_headline('social', h.title, h.query, '` + TitleHeadlineOptions + `')
+	FROM (
+		SELECT d.post_id, d.title, d.content, tq.query,
+			ts_rank_cd(d.search_vector, tq.query)::float8 AS rank
+		FROM search_documents d, websearch_to_tsquery('social', $1) tq(query)
+		WHERE d.search_vector @@ tq.query
+	) h
+	WHERE $3::float8 IS NULL OR (h.rank, h.post_id) ` + op + ` ($3::float8, $4::bigint)
+	ORDER BY h.rank ` + dir + `, h.post_id ` + dir + `
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := x.db.QueryContext(ctx, query, q.Text, q.Limit, afterRank, afterID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var hits []Hit
+
+	for rows.Next() {
+		var h Hit
+
+		if err := rows.Scan(&h.PostID, &h.Rank, &h.Snippet, &h.Title); err != nil {
+			return nil, err
+		}
+
+		h.Snippet = Highlight(h.Snippet)
+		h.Title = Highlight(h.Title)
+		hits = append(hits, h)
+	}
+
+	return hits, rows.Err()
+}
+
+// Prune compares before with indexed_at, both database times: callers read
+// it with Now.
+func (x *PostgresIndex) Prune(ctx context.Context, before time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := x.db.ExecContext(ctx, `DELETE FROM search_documents WHERE indexed_at < $1`, before)
+
+	return err
+}
+
+// Now returns the database time, to be given to Prune.
+func (x *PostgresIndex) Now(ctx context.Context) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var now time.Time
+
+	err := x.db.QueryRowContext(ctx, `SELECT NOW()`).Scan(&now)
+
+	return now, err
+}
+
+// Highlight escapes a snippet returned by ts_headline with HeadlineOptions
+// and marks its matches.
+func Highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+
+	return strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(escaped)
+}
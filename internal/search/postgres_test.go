@@ -0,0 +1,25 @@
+package search
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain", "nothing matched", "nothing matched"},
+		{"match", "small \x02tips\x03 about go", "small <mark>tips</mark> about go"},
+		{"several matches", "\x02go\x03 and \x02go\x03", "<mark>go</mark> and <mark>go</mark>"},
+		{"markup in the content", "\x02go\x03 <script>&", "<mark>go</mark> &lt;script&gt;&amp;"},
+		{"markup made up as a match", "<mark>go</mark>", "&lt;mark&gt;go&lt;/mark&gt;"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.snippet); got != tt.want {
+				t.Errorf("Highlight(%q) = %q, want %q", tt.snippet, got, tt.want)
+			}
+		})
+	}
+}
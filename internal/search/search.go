@@ -0,0 +1,69 @@
+// Package search indexes posts for full-text search. Handlers only depend on
+// Index, so the engine behind it can change without touching them.
+package search
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Document is the searchable part of a published post. Version is the
+// version of the post it was built from: a document never replaces one built
+// from a later version.
+type Document struct {
+	PostID      int64
+	UserID      int64
+	Title       string
+	Content     string
+	Tags        []string
+	PublishedAt time.Time
+	Version     int64
+}
+
+// Hit is a document matching a query. Snippet is HTML: the content around
+// the matches, escaped, with the matches wrapped in <mark> tags. Title is the
+// whole title, marked the same way.
+type Hit struct {
+	PostID  int64
+	Rank    float64
+	Snippet string
+	Title   string
+}
+
+// Key identifies the position of the hit in the results, for pagination.
+func (h Hit) Key() (string, int64) {
+	return strconv.FormatFloat(h.Rank, 'g', -1, 64), h.PostID
+}
+
+type Query struct {
+	// Text is the query in web search syntax.
+	Text  string
+	Limit int
+	// After resumes the results past a hit. With Before set, the results
+	// before it are returned instead, closest first.
+	After  *Hit
+	Before bool
+}
+
+// Index holds one document per post. Results come most relevant first, ties
+// broken by the highest post ID. Indexes do not know who is searching: the
+// caller filters out the posts the viewer cannot read.
+type Index interface {
+	Upsert(ctx context.Context, docs []Document) error
+	Delete(ctx context.Context, postIDs []int64) error
+	Search(ctx context.Context, q Query) ([]Hit, error)
+	// Prune removes the documents not upserted since the given time, after
+	// a full rebuild.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// follows reports whether hit comes after the from hit in results walked
+// most relevant first, or before it when before is set.
+func follows(hit Hit, from Hit, before bool) bool {
+	if before {
+		return hit.Rank > from.Rank || hit.Rank == from.Rank && hit.PostID > from.PostID
+	}
+
+	return hit.Rank < from.Rank || hit.Rank == from.Rank && hit.PostID < from.PostID
+}
@@ -4,26 +4,70 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/lib/pq"
 )
 
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   string    `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID         int64     `json:"id"`
+	Content    string    `json:"content"`
+	Title      string    `json:"title"`
+	UserID     int64     `json:"user_id"`
+	Tags       []string  `json:"tags"`
+	CreatedAt  string    `json:"created_at"`
+	UpdatedAt  string    `json:"updated_at"`
+	Version    string    `json:"version"`
+	Comments   []Comment `json:"comments"`
+	User       User      `json:"user"`
+	Bookmarked bool      `json:"bookmarked"`
+	Visibility string    `json:"visibility"`
+	// Mentions holds the IDs of the users mentioned in the post, who can read
+	// it when its visibility is VisibilityMentioned. It includes the users
+	// @mentioned in the content.
+	Mentions []int64 `json:"mentions,omitempty"`
+	// Entities locates the resolved @mentions and the #hashtags in Content.
+	Entities []PostEntity `json:"entities,omitempty"`
+	// Status is StatusDraft, StatusScheduled or StatusPublished. Scheduled
+	// posts are published by the scheduler once PublishAt is reached.
+	Status      string  `json:"status"`
+	PublishAt   *string `json:"publish_at,omitempty"`
+	PublishedAt *string `json:"published_at,omitempty"`
+	// Edited is set once a published post had its title or content changed,
+	// EditedAt being the time of the last such change.
+	Edited   bool    `json:"edited"`
+	EditedAt *string `json:"edited_at,omitempty"`
+	// EditorID is the user performing an update, recorded on the revision.
+	EditorID  int64   `json:"-"`
+	DeletedAt *string `json:"deleted_at,omitempty"`
+	// Attachments are ordered by position.
+	Attachments []Attachment `json:"attachments"`
+	Poll        *Poll        `json:"poll,omitempty"`
+	DeletedBy   *int64       `json:"deleted_by,omitempty"`
+	// RepostOfID references the original post of a plain repost (IsRepost)
+	// or of a quote post carrying its own commentary.
+	RepostOfID          *int64 `json:"repost_of_id,omitempty"`
+	RepostOf            *Post  `json:"repost_of,omitempty"`
+	IsRepost            bool   `json:"is_repost"`
+	RepostCount         int    `json:"repost_count"`
+	OriginalUnavailable bool   `json:"original_unavailable,omitempty"`
 }
 
 type PostWithMetaData struct {
 	Post
-	CommentCount int `json:"comment_count"`
+	CommentCount int    `json:"comment_count"`
+	RepostedBy   *User  `json:"reposted_by,omitempty"`
+	RepostedAt   string `json:"reposted_at,omitempty"`
+	// activityAt and activityID identify the feed entry (the post or the
+	// repost that brought it in) for pagination.
+	activityAt string
+	activityID int64
+}
+
+// FeedPosition is the keyset position of the feed entry.
+func (p PostWithMetaData) FeedPosition() (string, int64) {
+	return p.activityAt, p.activityID
 }
 
 type PostsStore struct {
@@ -31,33 +75,156 @@ type PostsStore struct {
 }
 
 func (s *PostsStore) Create(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.create(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if post.RepostOfID != nil {
+			return s.incrementRepostCount(ctx, tx, *post.RepostOfID, 1)
+		}
+
+		return nil
+	})
+}
+
+func (s *PostsStore) create(ctx context.Context, tx *sql.Tx, post *Post) error {
 	query := `
-	INSERT INTO posts (content, title, user_id, tags)
-	VALUES($1,$2,$3,$4)
-	RETURNING id, created_at, updated_at
+	INSERT INTO posts (content, title, user_id, tags, repost_of_id, is_repost, visibility, status, publish_at, published_at)
+	VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9, CASE WHEN $8 = 'published' THEN NOW() END)
+	RETURNING id, created_at, updated_at, published_at
 	`
+
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
+	}
+
+	if post.Status == "" {
+		post.Status = StatusPublished
+	}
+
+	if err := extractEntities(ctx, tx, post); err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+	err := tx.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags), post.RepostOfID, post.IsRepost, post.Visibility, post.Status, post.PublishAt).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt, &post.PublishedAt)
 
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
 		return err
 	}
 
-	return nil
+	if err := s.setMentions(ctx, tx, post.ID, post.Mentions); err != nil {
+		return err
+	}
+
+	if err := saveEntities(ctx, tx, post); err != nil {
+		return err
+	}
+
+	if err := recordTags(ctx, tx, post.Tags); err != nil {
+		return err
+	}
+
+	if post.Poll != nil {
+		if err := createPoll(ctx, tx, post); err != nil {
+			return err
+		}
+	}
+
+	if err := enqueueSearchSync(ctx, tx, post.ID); err != nil {
+		return err
+	}
+
+	return attachToPost(ctx, tx, post)
+}
+
+func (s *PostsStore) setMentions(ctx context.Context, tx *sql.Tx, postID int64, mentions []int64) error {
+	query := `
+	DELETE FROM post_mentions
+	WHERE post_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, query, postID); err != nil {
+		return err
+	}
+
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	query = `
+	INSERT INTO post_mentions (post_id, user_id)
+	SELECT $1, u.id FROM users u WHERE u.id = ANY($2)
+	ON CONFLICT DO NOTHING`
+
+	_, err := tx.ExecContext(ctx, query, postID, pq.Array(mentions))
+
+	return err
+}
+
+func (s *PostsStore) getMentions(ctx context.Context, postID int64) ([]int64, error) {
+	query := `
+	SELECT user_id FROM post_mentions
+	WHERE post_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var mentions []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		mentions = append(mentions, id)
+	}
+
+	return mentions, rows.Err()
 }
 
 func (s *PostsStore) GetById(ctx context.Context, id int64) (*Post, error) {
+	return s.getPost(ctx, id, nil)
+}
+
+// GetVisibleById returns the post only when the viewer is allowed to read it,
+// reporting ErrNotFound otherwise so hidden posts are indistinguishable from
+// missing ones.
+func (s *PostsStore) GetVisibleById(ctx context.Context, id, viewerID int64) (*Post, error) {
+	return s.getPost(ctx, id, &viewerID)
+}
+
+func (s *PostsStore) getPost(ctx context.Context, id int64, viewerID *int64) (*Post, error) {
 	var post Post
 
 	query := `
-	SELECT * from posts
-	WHERE id = $1`
+	SELECT p.id, p.content, p.title, p.user_id, u.username, p.tags, p.version, p.created_at, p.updated_at,
+		p.repost_of_id, p.is_repost, p.repost_count, p.visibility, p.status, p.publish_at, p.published_at, p.edited_at
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.id = $1 AND p.deleted_at IS NULL AND ($2::bigint IS NULL OR ` + visibleTo("p", "$2") + `)`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.Version, &post.CreatedAt, &post.UpdatedAt)
+	err := s.db.QueryRowContext(ctx, query, id, viewerID).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, &post.User.Username, pq.Array(&post.Tags), &post.Version, &post.CreatedAt, &post.UpdatedAt, &post.RepostOfID, &post.IsRepost, &post.RepostCount, &post.Visibility, &post.Status, &post.PublishAt, &post.PublishedAt, &post.EditedAt)
 
 	if err != nil {
 		switch {
@@ -69,78 +236,671 @@ func (s *PostsStore) GetById(ctx context.Context, id int64) (*Post, error) {
 			return nil, err
 		}
 	}
+
+	post.User.ID = post.UserID
+	post.Edited = post.EditedAt != nil
+
+	post.Mentions, err = s.getMentions(ctx, post.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	viewer := post.UserID
+
+	if viewerID != nil {
+		viewer = *viewerID
+	}
+
+	if err := s.attachOriginals(ctx, []*Post{&post}, viewer); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachPolls(ctx, []*Post{&post}, viewer); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachMedia(ctx, []*Post{&post}); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachEntities(ctx, []*Post{&post}); err != nil {
+		return nil, err
+	}
+
 	return &post, nil
 }
 
-func (s *PostsStore) DeletePost(ctx context.Context, id int64) error {
+// GetByIds returns the posts among ids the viewer can read, in no particular
+// order. Missing posts and posts of inactive authors are left out.
+func (s *PostsStore) GetByIds(ctx context.Context, ids []int64, viewerID int64) ([]Post, error) {
 	query := `
-		DELETE FROM posts
-		WHERE id = $1;
-	`
+	SELECT p.id, p.content, p.title, p.user_id, p.tags, p.version, p.created_at, p.updated_at, p.repost_count, p.visibility, p.status, p.published_at, p.edited_at, u.username
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.id = ANY($1) AND u.is_active = true AND ` + visibleTo("p", "$2")
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(ctx, query, id)
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids), viewerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []Post{}
+
+	for rows.Next() {
+		var p Post
+
+		err := rows.Scan(&p.ID, &p.Content, &p.Title, &p.UserID, pq.Array(&p.Tags), &p.Version, &p.CreatedAt, &p.UpdatedAt, &p.RepostCount, &p.Visibility, &p.Status, &p.PublishedAt, &p.EditedAt, &p.User.Username)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.User.ID = p.UserID
+		p.Edited = p.EditedAt != nil
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// attachOriginals hydrates RepostOf for reposts and quote posts in a single
+// query, flagging the ones whose original was deleted or is no longer visible.
+func (s *PostsStore) attachOriginals(ctx context.Context, posts []*Post, viewerID int64) error {
+	var ids []int64
+
+	for _, p := range posts {
+		if p.RepostOfID != nil {
+			ids = append(ids, *p.RepostOfID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	originals, err := s.GetByIds(ctx, ids, viewerID)
 
 	if err != nil {
 		return err
 	}
 
-	rows, err := res.RowsAffected()
+	byID := make(map[int64]*Post, len(originals))
+
+	for i := range originals {
+		byID[originals[i].ID] = &originals[i]
+	}
+
+	for _, p := range posts {
+		if p.RepostOfID == nil {
+			continue
+		}
+
+		original, ok := byID[*p.RepostOfID]
+
+		if !ok {
+			p.OriginalUnavailable = true
+			continue
+		}
+
+		p.RepostOf = original
+	}
+
+	return nil
+}
+
+// withOriginals returns the posts followed by the originals they quote, for
+// hydrating both in the same queries.
+func withOriginals(posts []*Post) ([]*Post, []int64) {
+	var all []*Post
+
+	for _, p := range posts {
+		all = append(all, p)
+
+		if p.RepostOf != nil {
+			all = append(all, p.RepostOf)
+		}
+	}
+
+	ids := make([]int64, len(all))
+
+	for i, p := range all {
+		ids[i] = p.ID
+	}
+
+	return all, ids
+}
+
+// attachPolls loads the polls of the posts, and of the originals they quote,
+// as seen by the viewer.
+func (s *PostsStore) attachPolls(ctx context.Context, posts []*Post, viewerID int64) error {
+	all, ids := withOriginals(posts)
+
+	if len(all) == 0 {
+		return nil
+	}
+
+	polls, err := getPollsByPosts(ctx, s.db, ids, viewerID)
 
 	if err != nil {
 		return err
 	}
 
-	if rows == 0 {
-		return ErrNotFound
+	for _, p := range all {
+		p.Poll = polls[p.ID]
 	}
 
 	return nil
 }
 
-func (s *PostsStore) Update(ctx context.Context, post *Post) error {
+// attachMedia loads the attachments of the posts, and of the originals they
+// quote.
+func (s *PostsStore) attachMedia(ctx context.Context, posts []*Post) error {
+	all, ids := withOriginals(posts)
+
+	if len(all) == 0 {
+		return nil
+	}
+
+	attachments, err := getAttachmentsByPosts(ctx, s.db, ids)
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range all {
+		p.Attachments = attachments[p.ID]
+	}
+
+	return nil
+}
+
+// attachEntities loads the mentions and hashtags of the posts, and of the
+// originals they quote.
+func (s *PostsStore) attachEntities(ctx context.Context, posts []*Post) error {
+	all, ids := withOriginals(posts)
+
+	if len(all) == 0 {
+		return nil
+	}
+
+	found, err := getEntities(ctx, s.db, ids)
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range all {
+		p.Entities = found[p.ID]
+	}
+
+	return nil
+}
+
+// Unrepost moves the user's plain repost of the original post to the trash,
+// like DeletePost, so that it can be restored with the other posts.
+func (s *PostsStore) Unrepost(ctx context.Context, userID, originalID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE posts
+		SET deleted_at = NOW(), deleted_by = $1
+		WHERE user_id = $1 AND repost_of_id = $2 AND is_repost = true AND deleted_at IS NULL`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID, originalID)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		return s.incrementRepostCount(ctx, tx, originalID, -1)
+	})
+}
+
+func (s *PostsStore) incrementRepostCount(ctx context.Context, tx *sql.Tx, id int64, delta int) error {
 	query := `
 		UPDATE posts
-		SET title = $1, content =$2, version = version +1
-		WHERE id = $3 AND version = $4
-		RETURNING version;
+		SET repost_count = GREATEST(repost_count + $2, 0)
+		WHERE id = $1
 	`
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
 
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
+	_, err := tx.ExecContext(ctx, query, id, delta)
+
+	return err
+}
+
+func (s *PostsStore) Update(ctx context.Context, post *Post) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := createRevision(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := stripEntities(ctx, tx, post); err != nil {
 			return err
 		}
 
+		if err := extractEntities(ctx, tx, post); err != nil {
+			return err
+		}
+
+		query := `
+		UPDATE posts
+		SET title = $1, content =$2, visibility = $5, status = $6, publish_at = $7, tags = $8,
+			published_at = CASE WHEN $6 = 'published' THEN COALESCE(published_at, NOW()) END,
+			edited_at = CASE
+				WHEN status = 'published' AND (title, content) IS DISTINCT FROM ($1, $2) THEN NOW()
+				ELSE edited_at
+			END,
+			version = version +1
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+		RETURNING version, published_at, edited_at;
+	`
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		err := tx.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version, post.Visibility, post.Status, post.PublishAt, pq.Array(post.Tags)).Scan(&post.Version, &post.PublishedAt, &post.EditedAt)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+
+		}
+
+		post.Edited = post.EditedAt != nil
+
+		if err := saveEntities(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := recordTags(ctx, tx, post.Tags); err != nil {
+			return err
+		}
+
+		if err := enqueueSearchSync(ctx, tx, post.ID); err != nil {
+			return err
+		}
+
+		return s.setMentions(ctx, tx, post.ID, post.Mentions)
+	})
+}
+
+// postListColumns are the columns scanned by listPosts, for queries joining
+// posts p with their author u. They must be followed by the time the list is
+// ordered by.
+const postListColumns = `p.id, p.content, p.title, p.user_id, u.username, p.tags, p.version, p.created_at, p.updated_at,
+	p.repost_of_id, p.is_repost, p.repost_count, p.visibility, p.status, p.published_at, p.edited_at`
+
+// listPosts runs a query selecting postListColumns and the ordering time,
+// limited to fq.Limit+1 rows, then paginates and hydrates the posts as seen
+// by the viewer.
+func (s *PostsStore) listPosts(ctx context.Context, viewerID int64, fq PaginatedFeedQuery, query string, args ...any) ([]Post, Page, error) {
+	type listed struct {
+		post Post
+		at   string
 	}
 
-	return nil
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	defer rows.Close()
+
+	var items []listed
+
+	for rows.Next() {
+		var l listed
+		p := &l.post
+
+		err := rows.Scan(&p.ID, &p.Content, &p.Title, &p.UserID, &p.User.Username, pq.Array(&p.Tags), &p.Version, &p.CreatedAt, &p.UpdatedAt,
+			&p.RepostOfID, &p.IsRepost, &p.RepostCount, &p.Visibility, &p.Status, &p.PublishedAt, &p.EditedAt, &l.at)
+
+		if err != nil {
+			return nil, Page{}, err
+		}
+
+		p.User.ID = p.UserID
+		p.Edited = p.EditedAt != nil
+		items = append(items, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	items, page := Paginate(items, fq, func(l listed) (string, int64) {
+		return l.at, l.post.ID
+	})
+
+	posts := make([]Post, len(items))
+	ptrs := make([]*Post, len(items))
+
+	for i := range items {
+		posts[i] = items[i].post
+		ptrs[i] = &posts[i]
+	}
+
+	if err := s.attachOriginals(ctx, ptrs, viewerID); err != nil {
+		return nil, Page{}, err
+	}
+
+	if err := s.attachPolls(ctx, ptrs, viewerID); err != nil {
+		return nil, Page{}, err
+	}
+
+	if err := s.attachMedia(ctx, ptrs); err != nil {
+		return nil, Page{}, err
+	}
+
+	if err := s.attachEntities(ctx, ptrs); err != nil {
+		return nil, Page{}, err
+	}
+
+	return posts, page, nil
 }
 
-func (s *PostsStore) GetUserFeed(ctx context.Context, id int64, Pag PaginatedFeedQuery) ([]PostWithMetaData, error) {
+// GetMentioning lists the posts mentioning the user that they can read, most
+// recent first by default. Their own posts are left out.
+func (s *PostsStore) GetMentioning(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]Post, Page, error) {
+	ks := fq.keysetClause("p.created_at", "p.id", 4)
+
 	query := `
-	SELECT p.id, p.user_id, p.content, p.created_at, p.version,p.tags,
-	COUNT(c.id) AS comments_counts 
+	SELECT ` + postListColumns + `, p.created_at
+	FROM post_mentions pm
+	JOIN posts p ON p.id = pm.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE pm.user_id = $1 AND p.user_id <> $1 AND ` + visibleTo("p", "$1") + ` AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $2 OFFSET $3`
+
+	args := append([]any{userID, fq.Limit + 1, ks.offset}, ks.args...)
+
+	return s.listPosts(ctx, userID, fq, query, args...)
+}
+
+// GetHydratedByIds is GetByIds with the originals, polls and media of the
+// posts loaded, for lists built outside of SQL such as trending posts.
+func (s *PostsStore) GetHydratedByIds(ctx context.Context, ids []int64, viewerID int64) ([]Post, error) {
+	query := `
+	SELECT ` + postListColumns + `, p.created_at
 	FROM posts p
-	LEFT JOIN comments c ON c.post_id = p.id
-	LEFT JOIN users u ON p user_id = u.id
-	JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-	WHERE 
-		f.user_id = $1 OR p.user_id = $1 AND 
-		(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
-		(p.tags @> $5 OR $5 = '{}')
-	GROUP BY p.id
-	ORDER BY p.creadted_at ` + Pag.Sort + `
+	JOIN users u ON u.id = p.user_id
+	WHERE p.id = ANY($1) AND u.is_active = true AND ` + visibleTo("p", "$2")
+
+	posts, _, err := s.listPosts(ctx, viewerID, PaginatedFeedQuery{Limit: len(ids)}, query, pq.Array(ids), viewerID)
+
+	return posts, err
+}
+
+// GetPublicTimeline lists every public published post, newest first by
+// default, leaving plain reposts out. It honours the tags, search, since and
+// until filters of the query.
+func (s *PostsStore) GetPublicTimeline(ctx context.Context, viewerID int64, fq PaginatedFeedQuery) ([]Post, Page, error) {
+	ks := fq.keysetClause("p.published_at", "p.id", 7)
+
+	query := `
+	SELECT ` + postListColumns + `, p.published_at
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.visibility = 'public' AND p.status = 'published' AND p.deleted_at IS NULL
+		AND NOT p.is_repost AND u.is_active = true
+		AND ($1 = '' OR p.search_vector @@ websearch_to_tsquery('` + searchConfig + `', $1))
+		AND (COALESCE(cardinality($2::text[]), 0) = 0 OR p.tags @> $2)
+		AND ($3::text = '' OR p.published_at >= NULLIF($3::text, '')::timestamptz)
+		AND ($4::text = '' OR p.published_at <= NULLIF($4::text, '')::timestamptz)
+		AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $5 OFFSET $6`
+
+	args := append([]any{fq.Search, pq.Array(fq.Tags), fq.Since, fq.Until, fq.Limit + 1, ks.offset}, ks.args...)
+
+	return s.listPosts(ctx, viewerID, fq, query, args...)
+}
+
+// GetByTag lists the posts carrying the normalized tag that the viewer can
+// read, by publication time: a scheduled post shows up when it goes out, not
+// when it was written.
+func (s *PostsStore) GetByTag(ctx context.Context, tag string, viewerID int64, fq PaginatedFeedQuery) ([]Post, Page, error) {
+	ks := fq.keysetClause("p.published_at", "p.id", 5)
+
+	query := `
+	SELECT ` + postListColumns + `, p.published_at
+	FROM posts p
+	JOIN users u ON u.id = p.user_id
+	WHERE p.tags @> ARRAY[$1] AND ` + visibleTo("p", "$2") + ` AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $3 OFFSET $4`
+
+	args := append([]any{tag, viewerID, fq.Limit + 1, ks.offset}, ks.args...)
+
+	return s.listPosts(ctx, viewerID, fq, query, args...)
+}
+
+// GetDrafts lists the user's drafts and scheduled posts, most recently
+// updated first.
+func (s *PostsStore) GetDrafts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]Post, error) {
+	query := `
+	SELECT id, content, title, user_id, tags, version, created_at, updated_at, visibility, status, publish_at
+	FROM posts
+	WHERE user_id = $1 AND status IN ('draft', 'scheduled') AND deleted_at IS NULL
+	ORDER BY updated_at ` + fq.Sort + `
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	drafts := []Post{}
+
+	for rows.Next() {
+		var p Post
+
+		err := rows.Scan(&p.ID, &p.Content, &p.Title, &p.UserID, pq.Array(&p.Tags), &p.Version, &p.CreatedAt, &p.UpdatedAt, &p.Visibility, &p.Status, &p.PublishAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		drafts = append(drafts, p)
+	}
+
+	return drafts, rows.Err()
+}
+
+// PublishDue publishes up to limit scheduled posts whose publish_at has
+// passed. Rows are claimed with FOR UPDATE SKIP LOCKED so several API
+// instances can run the scheduler without publishing a post twice.
+func (s *PostsStore) PublishDue(ctx context.Context, limit int) ([]int64, error) {
+	query := `
+	WITH published AS (
+		UPDATE posts
+		SET status = 'published', published_at = publish_at, updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM posts
+			WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	), synced AS (
+		INSERT INTO search_outbox (post_id) SELECT id FROM published
+	)
+	SELECT id FROM published`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetUserFeed returns the posts of the user and the users they follow. Plain
+// reposts are shown as their original post attributed to the reposter, and an
+// original reached through several reposts only appears once, at its latest
+// activity.
+func (s *PostsStore) GetUserFeed(ctx context.Context, id int64, Pag PaginatedFeedQuery) ([]PostWithMetaData, Page, error) {
+	ks := Pag.keysetClause("d.created_at", "d.id", 6)
+
+	candidates := `
+		SELECT p.id, p.user_id, p.published_at AS created_at,
+			CASE WHEN p.is_repost THEN p.repost_of_id ELSE p.id END AS display_id
+		FROM posts p
+		WHERE ` + inUserFeed("p", "$1")
+
+	filters := `
+		($4 = '' OR p.search_vector @@ websearch_to_tsquery('` + searchConfig + `', $4)) AND
+		(COALESCE(cardinality($5::text[]), 0) = 0 OR p.tags @> $5) AND
+		` + ks.cond
+
+	query := feedQuery(candidates, filters) + `
+	ORDER BY ` + ks.order + `
 	LIMIT $2 OFFSET $3;`
 
-	rows, err := s.db.QueryContext(ctx, query, id, Pag.Limit, Pag.Offset, Pag.Search, pq.Array(Pag.Tags))
+	args := append([]any{id, Pag.Limit + 1, ks.offset, Pag.Search, pq.Array(Pag.Tags)}, ks.args...)
+
+	feed, err := s.queryFeed(ctx, query, args...)
+
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	feed, page := Paginate(feed, Pag, PostWithMetaData.FeedPosition)
+
+	if err := s.hydrateFeed(ctx, feed, id); err != nil {
+		return nil, Page{}, err
+	}
+
+	return feed, page, nil
+}
+
+// GetFeedByIds loads the feed entries with the given post IDs as seen by the
+// viewer, most recent first, in a single query. It serves timelines built
+// outside of SQL: reposts are resolved like in GetUserFeed and the posts the
+// viewer can no longer read are left out. With latest set, an original only
+// shows up at its latest activity in the whole home feed of the viewer, not
+// just among ids, for feeds read in several batches.
+func (s *PostsStore) GetFeedByIds(ctx context.Context, viewerID int64, ids []int64, latest bool) ([]PostWithMetaData, error) {
+	candidates := `
+		SELECT p.id, p.user_id, p.published_at AS created_at,
+			CASE WHEN p.is_repost THEN p.repost_of_id ELSE p.id END AS display_id
+		FROM posts p
+		WHERE p.id = ANY($2) AND p.status = 'published' AND p.deleted_at IS NULL
+			AND (NOT $3 OR NOT EXISTS (
+				SELECT 1 FROM posts l
+				WHERE ` + inUserFeed("l", "$1") + `
+					AND (l.id = CASE WHEN p.is_repost THEN p.repost_of_id ELSE p.id END
+						OR l.is_repost AND l.repost_of_id = CASE WHEN p.is_repost THEN p.repost_of_id ELSE p.id END)
+					AND (l.published_at, l.id) > (p.published_at, p.id)
+			))`
+
+	query := feedQuery(candidates, "TRUE") + `
+	ORDER BY d.created_at DESC, d.id DESC;`
+
+	feed, err := s.queryFeed(ctx, query, viewerID, pq.Array(ids), latest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.hydrateFeed(ctx, feed, viewerID); err != nil {
+		return nil, err
+	}
+
+	return feed, nil
+}
+
+// inUserFeed returns the SQL predicate deciding whether the post aliased as
+// alias belongs to the home feed of the user bound to the user placeholder:
+// their own published posts, and those of the accounts and tags they follow.
+func inUserFeed(alias, user string) string {
+	return fmt.Sprintf(`%[1]s.status = 'published' AND %[1]s.deleted_at IS NULL AND
+			(%[1]s.user_id = %[2]s OR %[1]s.user_id IN (SELECT user_id FROM followers WHERE follower_id = %[2]s)
+				OR %[1]s.tags && ARRAY(SELECT tag FROM tag_follows WHERE user_id = %[2]s))`, alias, user)
+}
+
+// feedQuery builds the feed select over the candidate entries, which must
+// select id, user_id, created_at and display_id. The viewer is bound to $1.
+func feedQuery(candidates, filters string) string {
+	return `
+	WITH candidates AS (` + candidates + `
+	), deduped AS (
+		SELECT DISTINCT ON (display_id) id, user_id, created_at, display_id
+		FROM candidates
+		ORDER BY display_id, created_at DESC
+	)
+	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username,
+	p.repost_of_id, p.repost_count, p.visibility, p.status, p.published_at, p.edited_at,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_counts,
+	EXISTS (SELECT 1 FROM bookmarks b WHERE b.post_id = p.id AND b.user_id = $1) AS bookmarked,
+	ru.id, ru.username, d.created_at, d.id
+	FROM deduped d
+	JOIN posts p ON p.id = d.display_id
+	JOIN users u ON p.user_id = u.id AND u.is_active = true
+	LEFT JOIN users ru ON ru.id = d.user_id AND d.id <> p.id
+	WHERE 
+		` + visibleTo("p", "$1") + ` AND ` + filters
+}
+
+func (s *PostsStore) queryFeed(ctx context.Context, query string, args ...any) ([]PostWithMetaData, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 
 	if err != nil {
 		return nil, err
@@ -152,6 +912,8 @@ func (s *PostsStore) GetUserFeed(ctx context.Context, id int64, Pag PaginatedFee
 
 	for rows.Next() {
 		var p PostWithMetaData
+		var repostedByID sql.NullInt64
+		var repostedByUsername sql.NullString
 
 		err = rows.Scan(
 			&p.ID,
@@ -160,16 +922,122 @@ func (s *PostsStore) GetUserFeed(ctx context.Context, id int64, Pag PaginatedFee
 			&p.Content,
 			&p.CreatedAt,
 			&p.Version,
-			pq.Array(p.Tags),
+			pq.Array(&p.Tags),
 			&p.User.Username,
+			&p.RepostOfID,
+			&p.RepostCount,
+			&p.Visibility,
+			&p.Status,
+			&p.PublishedAt,
+			&p.EditedAt,
 			&p.CommentCount,
+			&p.Bookmarked,
+			&repostedByID,
+			&repostedByUsername,
+			&p.activityAt,
+			&p.activityID,
 		)
 
 		if err != nil {
 			return nil, err
 		}
 
+		p.Edited = p.EditedAt != nil
+
+		if repostedByID.Valid {
+			p.RepostedBy = &User{ID: repostedByID.Int64, Username: repostedByUsername.String}
+			p.RepostedAt = p.activityAt
+		}
+
 		feed = append(feed, p)
 	}
-	return feed, nil
+
+	return feed, rows.Err()
+}
+
+// hydrateFeed loads the quoted originals, polls and media of a feed page.
+func (s *PostsStore) hydrateFeed(ctx context.Context, feed []PostWithMetaData, viewerID int64) error {
+	quotes := make([]*Post, len(feed))
+
+	for i := range feed {
+		quotes[i] = &feed[i].Post
+	}
+
+	if err := s.attachOriginals(ctx, quotes, viewerID); err != nil {
+		return err
+	}
+
+	if err := s.attachPolls(ctx, quotes, viewerID); err != nil {
+		return err
+	}
+
+	if err := s.attachMedia(ctx, quotes); err != nil {
+		return err
+	}
+
+	return s.attachEntities(ctx, quotes)
+}
+
+// FeedEntry is a post delivered to a home timeline, at the time it was
+// published.
+type FeedEntry struct {
+	PostID int64
+	At     time.Time
+}
+
+// GetFeedEntries lists the published posts, reposts included, making up the
+// home timeline of the user in keyset order, up to fq.Limit entries. Accounts
+// followed by threshold users or more are celebrities whose posts are not
+// pushed to their followers' timelines. With pushed set, the entries are the
+// ones fan-out delivers: the user's own posts and those of the other accounts
+// they follow. Otherwise they are the ones pulled at read time: the posts of
+// the celebrities they follow and of the tags they follow.
+func (s *PostsStore) GetFeedEntries(ctx context.Context, userID int64, threshold int, pushed bool, fq PaginatedFeedQuery) ([]FeedEntry, error) {
+	ks := fq.keysetClause("p.published_at", "p.id", 6)
+
+	query := `
+	WITH followed AS (
+		SELECT f.user_id,
+			(SELECT COUNT(*) FROM followers c WHERE c.user_id = f.user_id) >= $2 AS celebrity
+		FROM followers f
+		WHERE f.follower_id = $1
+	)
+	SELECT p.id, p.published_at
+	FROM posts p
+	WHERE p.status = 'published' AND p.deleted_at IS NULL AND (
+		CASE WHEN $3 THEN
+			p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followed WHERE NOT celebrity)
+		ELSE
+			p.user_id IN (SELECT user_id FROM followed WHERE celebrity)
+				OR p.tags && ARRAY(SELECT tag FROM tag_follows WHERE user_id = $1)
+		END) AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $4 OFFSET $5`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	args := append([]any{userID, threshold, pushed, fq.Limit, ks.offset}, ks.args...)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []FeedEntry
+
+	for rows.Next() {
+		var e FeedEntry
+
+		if err := rows.Scan(&e.PostID, &e.At); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
 }
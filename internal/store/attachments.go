@@ -0,0 +1,478 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrAttachmentUnavailable = errors.New("attachment not found or already used")
+
+const (
+	AttachmentPending = "pending"
+	AttachmentReady   = "ready"
+	AttachmentFailed  = "failed"
+)
+
+// maxProcessingAttempts bounds how many times a worker picks up the same
+// upload before it is marked as failed.
+const maxProcessingAttempts = 3
+
+// Attachment is an uploaded image or video. It is created unattached and
+// becomes part of a post once referenced when the post is created, or the
+// user's avatar once set as such.
+//
+// Images start pending: the original upload is never served, only the
+// variants generated by the processing pipeline. URL points to the largest
+// variant once the attachment is ready.
+type Attachment struct {
+	ID          int64               `json:"id"`
+	UserID      int64               `json:"user_id"`
+	PostID      *int64              `json:"post_id,omitempty"`
+	Key         string              `json:"-"`
+	URL         string              `json:"url"`
+	ContentType string              `json:"content_type"`
+	Size        int64               `json:"size"`
+	AltText     string              `json:"alt_text"`
+	Position    int                 `json:"position"`
+	Status      string              `json:"status"`
+	Width       *int                `json:"width,omitempty"`
+	Height      *int                `json:"height,omitempty"`
+	Blurhash    string              `json:"blurhash,omitempty"`
+	Variants    []AttachmentVariant `json:"variants,omitempty"`
+	CreatedAt   string              `json:"created_at"`
+}
+
+type AttachmentVariant struct {
+	Name        string `json:"name"`
+	Key         string `json:"-"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type AttachmentsStore struct {
+	db *sql.DB
+}
+
+func (s *AttachmentsStore) Create(ctx context.Context, attachment *Attachment) error {
+	query := `
+	INSERT INTO attachments (user_id, blob_key, url, content_type, size, alt_text, status)
+	VALUES($1,$2,$3,$4,$5,$6,$7)
+	RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, attachment.UserID, attachment.Key, attachment.URL, attachment.ContentType, attachment.Size, attachment.AltText, attachment.Status).Scan(&attachment.ID, &attachment.CreatedAt)
+}
+
+// ClaimPending leases up to limit pending attachments to the caller for the
+// given duration. Attachments whose lease expired are handed out again, so a
+// crashed worker only delays processing; the ones that exhausted their
+// attempts that way are marked as failed.
+func (s *AttachmentsStore) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]Attachment, error) {
+	expire := `
+	UPDATE attachments
+	SET status = 'failed', locked_until = NULL
+	WHERE status = 'pending' AND attempts >= $1 AND locked_until < NOW()`
+
+	query := `
+	UPDATE attachments
+	SET attempts = attempts + 1, locked_until = NOW() + make_interval(secs => $2)
+	WHERE id IN (
+		SELECT id FROM attachments
+		WHERE status = 'pending' AND attempts < $3 AND (locked_until IS NULL OR locked_until < NOW())
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, user_id, post_id, blob_key, content_type, size, status, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, expire, maxProcessingAttempts); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds(), maxProcessingAttempts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var claimed []Attachment
+
+	for rows.Next() {
+		var a Attachment
+
+		err := rows.Scan(&a.ID, &a.UserID, &a.PostID, &a.Key, &a.ContentType, &a.Size, &a.Status, &a.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		claimed = append(claimed, a)
+	}
+
+	return claimed, rows.Err()
+}
+
+// CompleteProcessing stores the variants generated for a pending attachment
+// and marks it as ready, pointing its URL at the largest variant.
+func (s *AttachmentsStore) CompleteProcessing(ctx context.Context, attachment *Attachment) error {
+	if len(attachment.Variants) == 0 {
+		return errors.New("attachment has no variants")
+	}
+
+	largest := attachment.Variants[len(attachment.Variants)-1]
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+		UPDATE attachments
+		SET status = 'ready', locked_until = NULL, url = $2, content_type = $3, size = $4,
+			width = $5, height = $6, blurhash = $7
+		WHERE id = $1 AND status = 'pending'`
+
+		res, err := tx.ExecContext(ctx, query, attachment.ID, largest.URL, largest.ContentType, largest.Size, attachment.Width, attachment.Height, attachment.Blurhash)
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		variantQuery := `
+		INSERT INTO attachment_variants (attachment_id, name, blob_key, url, content_type, width, height, size)
+		VALUES($1,$2,$3,$4,$5,$6,$7,$8)`
+
+		for _, v := range attachment.Variants {
+			_, err := tx.ExecContext(ctx, variantQuery, attachment.ID, v.Name, v.Key, v.URL, v.ContentType, v.Width, v.Height, v.Size)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		attachment.Status = AttachmentReady
+		attachment.URL = largest.URL
+		attachment.ContentType = largest.ContentType
+		attachment.Size = largest.Size
+
+		return nil
+	})
+}
+
+// FailProcessing releases the lease on an attachment. It is retried later
+// when retry is set and attempts remain, otherwise it is marked as failed.
+func (s *AttachmentsStore) FailProcessing(ctx context.Context, id int64, retry bool) error {
+	query := `
+	UPDATE attachments
+	SET locked_until = NULL,
+		status = CASE WHEN $2 AND attempts < $3 THEN 'pending' ELSE 'failed' END
+	WHERE id = $1 AND status = 'pending'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, retry, maxProcessingAttempts)
+	return err
+}
+
+// KeepOriginal marks a pending attachment as ready without variants, serving
+// the upload itself from url.
+func (s *AttachmentsStore) KeepOriginal(ctx context.Context, id int64, url string) error {
+	query := `
+	UPDATE attachments
+	SET status = 'ready', locked_until = NULL, url = $2
+	WHERE id = $1 AND status = 'pending'`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id, url)
+	return err
+}
+
+// GetOrphans returns attachments that were never used by a post or as an
+// avatar, or whose post was purged, and are older than olderThan. Their
+// variants are loaded so the caller can delete every blob.
+func (s *AttachmentsStore) GetOrphans(ctx context.Context, olderThan time.Duration, limit int) ([]Attachment, error) {
+	query := `
+	SELECT id, user_id, blob_key, url, content_type, size, alt_text, position, status, created_at
+	FROM attachments a
+	WHERE post_id IS NULL AND created_at < NOW() - make_interval(secs => $1)
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_id = a.id)
+	ORDER BY created_at
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, olderThan.Seconds(), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var orphans []Attachment
+
+	for rows.Next() {
+		var a Attachment
+
+		err := rows.Scan(&a.ID, &a.UserID, &a.Key, &a.URL, &a.ContentType, &a.Size, &a.AltText, &a.Position, &a.Status, &a.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		orphans = append(orphans, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadVariants(ctx, s.db, orphans); err != nil {
+		return nil, err
+	}
+
+	return orphans, nil
+}
+
+// MediaAccess tells who can fetch a blob: anyone when Public, the viewer it
+// was computed for when Visible.
+type MediaAccess struct {
+	Public  bool
+	Visible bool
+}
+
+// GetMediaAccess looks up the attachment stored under key, as its original or
+// one of its variants. Avatars are public, media of a post follow the post's
+// visibility and unattached uploads are only visible to their uploader.
+func (s *AttachmentsStore) GetMediaAccess(ctx context.Context, key string, viewerID int64) (*MediaAccess, error) {
+	query := `
+	WITH target AS (
+		SELECT a.id, a.user_id, a.post_id
+		FROM attachments a
+		WHERE a.blob_key = $1 OR a.id = (SELECT v.attachment_id FROM attachment_variants v WHERE v.blob_key = $1)
+	), avatar AS (
+		SELECT EXISTS (SELECT 1 FROM users u JOIN target t ON u.avatar_id = t.id) AS used
+	)
+	SELECT
+		avatar.used OR COALESCE(p.deleted_at IS NULL AND p.status = 'published' AND p.visibility = 'public', false),
+		avatar.used OR CASE WHEN p.id IS NULL THEN t.user_id = $2 ELSE ` + visibleTo("p", "$2") + ` END
+	FROM target t
+	CROSS JOIN avatar
+	LEFT JOIN posts p ON p.id = t.post_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var access MediaAccess
+
+	err := s.db.QueryRowContext(ctx, query, key, viewerID).Scan(&access.Public, &access.Visible)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &access, nil
+}
+
+// Delete removes an attachment row as long as it is still unattached.
+func (s *AttachmentsStore) Delete(ctx context.Context, id int64) error {
+	query := `
+	DELETE FROM attachments a
+	WHERE id = $1 AND post_id IS NULL
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_id = a.id)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// attachToPost links the user's unattached uploads to the post, in the order
+// given, storing their alt text. Uploads that failed processing or serve as
+// an avatar are refused.
+func attachToPost(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `
+	UPDATE attachments a
+	SET post_id = $1, position = $2, alt_text = $3
+	WHERE id = $4 AND user_id = $5 AND post_id IS NULL AND status <> 'failed'
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_id = a.id)
+	RETURNING url, content_type, size, status, width, height, blurhash, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	for i := range post.Attachments {
+		a := &post.Attachments[i]
+		a.Position = i
+		a.PostID = &post.ID
+		a.UserID = post.UserID
+
+		err := tx.QueryRowContext(ctx, query, post.ID, a.Position, a.AltText, a.ID, post.UserID).Scan(&a.URL, &a.ContentType, &a.Size, &a.Status, &a.Width, &a.Height, &a.Blurhash, &a.CreatedAt)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrAttachmentUnavailable
+			default:
+				return err
+			}
+		}
+	}
+
+	return loadVariants(ctx, tx, post.Attachments)
+}
+
+// getAttachmentsByPosts loads the attachments of several posts at once, keyed
+// by post ID and ordered by position.
+func getAttachmentsByPosts(ctx context.Context, db *sql.DB, postIDs []int64) (map[int64][]Attachment, error) {
+	query := `
+	SELECT id, user_id, post_id, url, content_type, size, alt_text, position, status, width, height, blurhash, created_at
+	FROM attachments
+	WHERE post_id = ANY($1)
+	ORDER BY post_id, position`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var all []Attachment
+
+	for rows.Next() {
+		var a Attachment
+
+		err := rows.Scan(&a.ID, &a.UserID, &a.PostID, &a.URL, &a.ContentType, &a.Size, &a.AltText, &a.Position, &a.Status, &a.Width, &a.Height, &a.Blurhash, &a.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadVariants(ctx, db, all); err != nil {
+		return nil, err
+	}
+
+	attachments := make(map[int64][]Attachment)
+
+	for _, a := range all {
+		attachments[*a.PostID] = append(attachments[*a.PostID], a)
+	}
+
+	return attachments, nil
+}
+
+// loadVariants fills in the variants of the given attachments, smallest
+// first.
+func loadVariants(ctx context.Context, q queryer, attachments []Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(attachments))
+	ids := make([]int64, 0, len(attachments))
+
+	for i, a := range attachments {
+		index[a.ID] = i
+		ids = append(ids, a.ID)
+	}
+
+	query := `
+	SELECT attachment_id, name, blob_key, url, content_type, width, height, size
+	FROM attachment_variants
+	WHERE attachment_id = ANY($1)
+	ORDER BY attachment_id, width * height`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(ids))
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			attachmentID int64
+			v            AttachmentVariant
+		)
+
+		err := rows.Scan(&attachmentID, &v.Name, &v.Key, &v.URL, &v.ContentType, &v.Width, &v.Height, &v.Size)
+
+		if err != nil {
+			return err
+		}
+
+		a := &attachments[index[attachmentID]]
+		a.Variants = append(a.Variants, v)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type BookmarkCollection struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Bookmark struct {
+	UserID       int64  `json:"user_id"`
+	PostID       int64  `json:"post_id"`
+	CollectionID *int64 `json:"collection_id"`
+	CreatedAt    string `json:"created_at"`
+	Post         Post   `json:"post"`
+}
+
+type BookmarksStore struct {
+	db *sql.DB
+}
+
+func (s *BookmarksStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	query := `
+	INSERT INTO bookmark_collections (user_id, name)
+	VALUES($1,$2)
+	RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *BookmarksStore) GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	query := `
+	SELECT id, user_id, name, created_at
+	FROM bookmark_collections
+	WHERE user_id = $1
+	ORDER BY name ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	collections := []BookmarkCollection{}
+
+	for rows.Next() {
+		var c BookmarkCollection
+
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+func (s *BookmarksStore) DeleteCollection(ctx context.Context, userID, collectionID int64) error {
+	query := `
+	DELETE FROM bookmark_collections
+	WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, collectionID, userID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Add bookmarks a post for the user, moving it to the given collection if it
+// was already bookmarked. A nil collection keeps the bookmark unsorted.
+func (s *BookmarksStore) Add(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	query := `
+	INSERT INTO bookmarks (user_id, post_id, collection_id)
+	SELECT $1, $2, $3
+	WHERE $3::bigint IS NULL OR EXISTS (
+		SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1
+	)
+	ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, postID, collectionID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *BookmarksStore) Remove(ctx context.Context, userID, postID int64) error {
+	query := `
+	DELETE FROM bookmarks
+	WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, postID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetBookmarks lists the user's bookmarks ordered by when they were saved. A
+// nil collection lists every bookmark regardless of its collection.
+func (s *BookmarksStore) GetBookmarks(ctx context.Context, userID int64, collectionID *int64, fq PaginatedFeedQuery) ([]Bookmark, error) {
+	query := `
+	SELECT b.user_id, b.post_id, b.collection_id, b.created_at,
+		p.id, p.user_id, p.title, p.content, p.tags, p.version, p.created_at, p.updated_at, u.username
+	FROM bookmarks b
+	JOIN posts p ON p.id = b.post_id
+	JOIN users u ON u.id = p.user_id
+	WHERE b.user_id = $1 AND ($2::bigint IS NULL OR b.collection_id = $2) AND ` + visibleTo("p", "$1") + `
+	ORDER BY b.created_at ` + fq.Sort + `
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, collectionID, fq.Limit, fq.Offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	bookmarks := []Bookmark{}
+
+	for rows.Next() {
+		var b Bookmark
+
+		err := rows.Scan(
+			&b.UserID,
+			&b.PostID,
+			&b.CollectionID,
+			&b.CreatedAt,
+			&b.Post.ID,
+			&b.Post.UserID,
+			&b.Post.Title,
+			&b.Post.Content,
+			pq.Array(&b.Post.Tags),
+			&b.Post.Version,
+			&b.Post.CreatedAt,
+			&b.Post.UpdatedAt,
+			&b.Post.User.Username,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.Post.User.ID = b.Post.UserID
+		b.Post.Bookmarked = true
+		bookmarks = append(bookmarks, b)
+	}
+
+	return bookmarks, rows.Err()
+}
+
+func (s *BookmarksStore) IsBookmarked(ctx context.Context, userID, postID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM bookmarks WHERE user_id = $1 AND post_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var bookmarked bool
+
+	err := s.db.QueryRowContext(ctx, query, userID, postID).Scan(&bookmarked)
+
+	if err != nil {
+		return false, err
+	}
+
+	return bookmarked, nil
+}
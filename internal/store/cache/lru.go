@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a concurrency safe map bounded to capacity entries, evicting the
+// least recently used one when full. Entries also expire after their TTL.
+// Evictions are counted in the metrics under name.
+type lru[K comparable, V any] struct {
+	mu       sync.Mutex
+	name     string
+	capacity int
+	order    *list.List
+	items    map[K]*list.Element
+	now      func() time.Time
+}
+
+type lruEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+func newLRU[K comparable, V any](name string, capacity int) *lru[K, V] {
+	return &lru[K, V]{
+		name:     name,
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element, capacity),
+		now:      time.Now,
+	}
+}
+
+func (c *lru[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	el, ok := c.items[key]
+
+	if !ok {
+		return zero, false
+	}
+
+	entry := el.Value.(*lruEntry[K, V])
+
+	if c.now().After(entry.expiresAt) {
+		c.remove(el)
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return entry.value, true
+}
+
+func (c *lru[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	expiresAt := now.Add(ttl)
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry[K, V])
+		entry.value, entry.expiresAt = value, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expiresAt: expiresAt})
+
+	// expired entries are dropped as they reach the back, so that they do
+	// not take the place of live ones
+	for back := c.order.Back(); back != nil && now.After(back.Value.(*lruEntry[K, V]).expiresAt); back = c.order.Back() {
+		c.remove(back)
+	}
+
+	if c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		metrics.Add(c.name+"_evictions", 1)
+	}
+}
+
+func (c *lru[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lru[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[K, V]).key)
+}
+
+func (c *lru[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
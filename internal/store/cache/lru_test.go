@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"expvar"
+	"testing"
+	"time"
+)
+
+func newTestLRU(t *testing.T, capacity int) (*lru[string, int], *time.Time) {
+	t.Helper()
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	c := newLRU[string, int](t.Name(), capacity)
+	c.now = func() time.Time { return now }
+
+	return c, &now
+}
+
+func evictions(t *testing.T) int64 {
+	t.Helper()
+
+	if v, ok := metrics.Get(t.Name() + "_evictions").(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestLRU(t, 2)
+
+	c.Set("a", 1, time.Hour)
+	c.Set("b", 2, time.Hour)
+
+	// a is used again, so b is the one evicted
+	c.Get("a")
+	c.Set("c", 3, time.Hour)
+
+	tests := []struct {
+		key    string
+		want   int
+		wantOK bool
+	}{
+		{"a", 1, true},
+		{"b", 0, false},
+		{"c", 3, true},
+	}
+
+	for _, tt := range tests {
+		if got, ok := c.Get(tt.key); got != tt.want || ok != tt.wantOK {
+			t.Errorf("Get(%s) = %d, %v, want %d, %v", tt.key, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if got := evictions(t); got != 1 {
+		t.Errorf("evictions = %d, want 1", got)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		wantOK  bool
+		// expired entries are dropped when read
+		wantLen int
+	}{
+		{"fresh", time.Minute, 0, true, 1},
+		{"at its expiry", time.Minute, time.Minute, true, 1},
+		{"expired", time.Minute, time.Minute + 1, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, now := newTestLRU(t, 2)
+
+			c.Set("a", 1, tt.ttl)
+			*now = now.Add(tt.elapsed)
+
+			if _, ok := c.Get("a"); ok != tt.wantOK {
+				t.Errorf("Get() ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if c.Len() != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", c.Len(), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestLRUSetRefreshes(t *testing.T) {
+	c, now := newTestLRU(t, 2)
+
+	c.Set("a", 1, time.Minute)
+	*now = now.Add(30 * time.Second)
+	c.Set("a", 2, time.Minute)
+	*now = now.Add(45 * time.Second)
+
+	if got, ok := c.Get("a"); got != 2 || !ok {
+		t.Errorf("Get() = %d, %v, want the value set last, still fresh", got, ok)
+	}
+
+	if c.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", c.Len())
+	}
+}
+
+func TestLRUDropsExpiredBeforeEvicting(t *testing.T) {
+	c, now := newTestLRU(t, 2)
+
+	c.Set("b", 2, time.Minute)
+	c.Set("a", 1, time.Hour)
+
+	// b is the least recently used and expired: it makes room instead of
+	// evicting a
+	*now = now.Add(2 * time.Minute)
+	c.Set("c", 3, time.Hour)
+
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a was evicted, want the expired entry dropped instead")
+	}
+
+	if got := evictions(t); got != 0 {
+		t.Errorf("evictions = %d, want 0", got)
+	}
+}
+
+func TestLRUDelete(t *testing.T) {
+	c, _ := newTestLRU(t, 2)
+
+	c.Set("a", 1, time.Hour)
+	c.Delete("a")
+	c.Delete("unknown")
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get() found a deleted entry")
+	}
+
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", c.Len())
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		ttl      time.Duration
+		min, max time.Duration
+	}{
+		{time.Minute, 54 * time.Second, 66 * time.Second},
+		{time.Hour, 54 * time.Minute, 66 * time.Minute},
+		// too short to spread
+		{9, 9, 9},
+		{0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ttl.String(), func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				if got := jitter(tt.ttl); got < tt.min || got > tt.max {
+					t.Fatalf("jitter(%v) = %v, want it within [%v, %v]", tt.ttl, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+// NewMemoryStorage caches in process, up to size users and size posts, for
+// deployments without redis. Every instance has its own cache and only sees
+// its own invalidations, so it suits a single instance.
+func NewMemoryStorage(size int) Storage {
+	users := &MemoryUserStore{users: newLRU[int64, memoryUser]("users_memory", size)}
+	posts := &MemoryPostStore{posts: newLRU[int64, memoryPost]("posts_memory", size)}
+
+	metrics.Set("users_memory_entries", expvar.Func(func() any { return users.users.Len() }))
+	metrics.Set("posts_memory_entries", expvar.Func(func() any { return posts.posts.Len() }))
+
+	return Storage{
+		Users: users,
+		Posts: posts,
+	}
+}
+
+// memoryUser is a cached user, or a deleted one keeping its generation.
+type memoryUser struct {
+	user       store.User
+	freshUntil time.Time
+	generation int64
+	deleted    bool
+}
+
+// MemoryUserStore is the in-process counterpart of UserStore, with the same
+// TTLs and generations.
+type MemoryUserStore struct {
+	// mu makes the generation checks and the writes following them atomic.
+	mu    sync.Mutex
+	users *lru[int64, memoryUser]
+}
+
+func (s *MemoryUserStore) Get(ctx context.Context, id int64) (*store.User, bool, error) {
+	cached, ok := s.users.Get(id)
+
+	if !ok || cached.deleted {
+		metrics.Add("users_misses", 1)
+		return nil, false, nil
+	}
+
+	stale := time.Now().After(cached.freshUntil)
+
+	if stale {
+		metrics.Add("users_stale_hits", 1)
+	} else {
+		metrics.Add("users_hits", 1)
+	}
+
+	return &cached.user, stale, nil
+}
+
+func (s *MemoryUserStore) Generation(ctx context.Context, id int64) (int64, error) {
+	cached, _ := s.users.Get(id)
+
+	return cached.generation, nil
+}
+
+func (s *MemoryUserStore) Set(ctx context.Context, user *store.User, generation int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, _ := s.users.Get(user.ID); cached.generation != generation {
+		return ErrStale
+	}
+
+	ttl := jitter(userTTL)
+
+	s.users.Set(user.ID, memoryUser{user: *user, freshUntil: time.Now().Add(ttl), generation: generation}, ttl+userStaleTTL)
+
+	return nil
+}
+
+func (s *MemoryUserStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, _ := s.users.Get(id)
+
+	s.users.Set(id, memoryUser{generation: cached.generation + 1, deleted: true}, userTTL)
+
+	return nil
+}
+
+// memoryPost mirrors the redis pointer of a post: the version it is at and
+// its encoded data, if cached, or notFound for a post known not to exist,
+// along with its generation.
+type memoryPost struct {
+	version    int64
+	data       []byte
+	notFound   bool
+	generation int64
+}
+
+// MemoryPostStore is the in-process counterpart of PostStore, following the
+// same versioning rules. Posts are kept encoded so that callers cannot
+// change the cached copy.
+type MemoryPostStore struct {
+	// mu makes the version checks and the writes following them atomic.
+	mu    sync.Mutex
+	posts *lru[int64, memoryPost]
+}
+
+func (s *MemoryPostStore) Get(ctx context.Context, id int64) (*store.Post, error) {
+	cached, ok := s.posts.Get(id)
+
+	switch {
+	case ok && cached.notFound:
+		metrics.Add("posts_not_found_hits", 1)
+		return nil, store.ErrNotFound
+	case !ok || cached.data == nil:
+		metrics.Add("posts_misses", 1)
+		return nil, nil
+	}
+
+	metrics.Add("posts_hits", 1)
+
+	var post store.Post
+
+	if err := json.Unmarshal(cached.data, &post); err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+func (s *MemoryPostStore) MGet(ctx context.Context, ids []int64) (map[int64]*store.Post, error) {
+	posts := make(map[int64]*store.Post, len(ids))
+
+	for _, id := range ids {
+		post, err := s.Get(ctx, id)
+
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if post != nil {
+			posts[id] = post
+		}
+	}
+
+	return posts, nil
+}
+
+func (s *MemoryPostStore) Generation(ctx context.Context, id int64) (int64, error) {
+	cached, _ := s.posts.Get(id)
+
+	return cached.generation, nil
+}
+
+func (s *MemoryPostStore) Set(ctx context.Context, post *store.Post, generation int64) error {
+	version, err := strconv.ParseInt(post.Version, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("post %d has an invalid version %q", post.ID, post.Version)
+	}
+
+	data, err := json.Marshal(post)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.posts.Get(post.ID)
+
+	if current.generation != generation || ok && (current.notFound || current.version > version) {
+		return nil
+	}
+
+	s.posts.Set(post.ID, memoryPost{version: version, data: data, generation: generation}, jitter(postTTL))
+
+	return nil
+}
+
+func (s *MemoryPostStore) SetNotFound(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, _ := s.posts.Get(id)
+
+	s.posts.Set(id, memoryPost{notFound: true, generation: current.generation}, postNotFoundTTL)
+
+	return nil
+}
+
+func (s *MemoryPostStore) Delete(ctx context.Context, id int64, version string) error {
+	v, err := strconv.ParseInt(version, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("post %d has an invalid version %q", id, version)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.posts.Get(id)
+	current.generation++
+
+	if ok && !current.notFound && current.version > v {
+		s.posts.Set(id, current, postTTL)
+		return nil
+	}
+
+	s.posts.Set(id, memoryPost{version: v, generation: current.generation}, postTTL)
+
+	return nil
+}
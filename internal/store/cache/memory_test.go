@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+func TestMemoryUserStoreGenerations(t *testing.T) {
+	s := NewMemoryStorage(10).Users.(*MemoryUserStore)
+	ctx := context.Background()
+
+	before, _ := s.Generation(ctx, 1)
+
+	if err := s.Set(ctx, &store.User{ID: 1, Username: "alice"}, before); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, stale, _ := s.Get(ctx, 1); user == nil || user.Username != "alice" || stale {
+		t.Fatalf("Get() = %+v, %v, want alice, fresh", user, stale)
+	}
+
+	if err := s.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, _, _ := s.Get(ctx, 1); user != nil {
+		t.Fatalf("Get() = %+v after Delete, want a miss", user)
+	}
+
+	// a load started before the deletion
+	if err := s.Set(ctx, &store.User{ID: 1, Username: "alice"}, before); !errors.Is(err, ErrStale) {
+		t.Fatalf("Set() with the generation from before Delete: err = %v, want ErrStale", err)
+	}
+
+	if user, _, _ := s.Get(ctx, 1); user != nil {
+		t.Fatalf("Get() = %+v after a stale Set, want a miss", user)
+	}
+
+	after, _ := s.Generation(ctx, 1)
+
+	if after <= before {
+		t.Fatalf("Generation() = %d after Delete, want it past %d", after, before)
+	}
+
+	if err := s.Set(ctx, &store.User{ID: 1, Username: "alicia"}, after); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, _, _ := s.Get(ctx, 1); user == nil || user.Username != "alicia" {
+		t.Errorf("Get() = %+v, want the user loaded after Delete", user)
+	}
+}
+
+func TestMemoryPostStoreSet(t *testing.T) {
+	post := func(version int) *store.Post {
+		return &store.Post{ID: 1, Version: strconv.Itoa(version), Title: "v" + strconv.Itoa(version)}
+	}
+
+	set := func(ctx context.Context, s *MemoryPostStore, version int) {
+		generation, _ := s.Generation(ctx, 1)
+		s.Set(ctx, post(version), generation)
+	}
+
+	tests := []struct {
+		name string
+		// before runs before the generation Set is given is read, during
+		// after it, as a concurrent request would
+		before func(context.Context, *MemoryPostStore)
+		during func(context.Context, *MemoryPostStore)
+		set    int
+		// want is the title cached, "" for a miss
+		want        string
+		wantMissing bool
+	}{
+		{name: "empty", set: 2, want: "v2"},
+		{
+			name:   "older version",
+			before: func(ctx context.Context, s *MemoryPostStore) { set(ctx, s, 3) },
+			set:    2, want: "v3",
+		},
+		{
+			name:   "newer version",
+			before: func(ctx context.Context, s *MemoryPostStore) { set(ctx, s, 2) },
+			set:    3, want: "v3",
+		},
+		{
+			name:   "known not to exist",
+			before: func(ctx context.Context, s *MemoryPostStore) { s.SetNotFound(ctx, 1) },
+			set:    1, wantMissing: true,
+		},
+		{
+			name: "created after being looked up",
+			before: func(ctx context.Context, s *MemoryPostStore) {
+				s.SetNotFound(ctx, 1)
+				s.Delete(ctx, 1, "1")
+			},
+			set: 1, want: "v1",
+		},
+		{
+			name:   "invalidated while loading",
+			during: func(ctx context.Context, s *MemoryPostStore) { s.Delete(ctx, 1, "2") },
+			set:    2,
+		},
+		{
+			name:   "invalidated after a newer version was cached",
+			before: func(ctx context.Context, s *MemoryPostStore) { set(ctx, s, 3) },
+			during: func(ctx context.Context, s *MemoryPostStore) { s.Delete(ctx, 1, "2") },
+			set:    2, want: "v3",
+		},
+		{
+			name:   "loaded after an invalidation, at an older version",
+			before: func(ctx context.Context, s *MemoryPostStore) { s.Delete(ctx, 1, "3") },
+			set:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStorage(10).Posts.(*MemoryPostStore)
+			ctx := context.Background()
+
+			if tt.before != nil {
+				tt.before(ctx, s)
+			}
+
+			generation, _ := s.Generation(ctx, 1)
+
+			if tt.during != nil {
+				tt.during(ctx, s)
+			}
+
+			if err := s.Set(ctx, post(tt.set), generation); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.Get(ctx, 1)
+
+			if tt.wantMissing {
+				if !errors.Is(err, store.ErrNotFound) {
+					t.Fatalf("Get() = %+v, %v, want ErrNotFound", got, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var title string
+
+			if got != nil {
+				title = got.Title
+			}
+
+			if title != tt.want {
+				t.Errorf("cached %q, want %q", title, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryPostStoreMGet(t *testing.T) {
+	s := NewMemoryStorage(10).Posts.(*MemoryPostStore)
+	ctx := context.Background()
+
+	for _, id := range []int64{1, 3} {
+		if err := s.Set(ctx, &store.Post{ID: id, Version: "1"}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.SetNotFound(ctx, 2)
+
+	posts, err := s.MGet(ctx, []int64{1, 2, 3, 4})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 || posts[1] == nil || posts[3] == nil {
+		t.Errorf("MGet() = %v, want posts 1 and 3", posts)
+	}
+}
+
+func TestMemoryPostStoreInvalidVersion(t *testing.T) {
+	s := NewMemoryStorage(10).Posts.(*MemoryPostStore)
+	ctx := context.Background()
+
+	if err := s.Set(ctx, &store.Post{ID: 1, Version: "latest"}, 0); err == nil {
+		t.Error("Set() accepted an invalid version")
+	}
+
+	if err := s.Delete(ctx, 1, ""); err == nil {
+		t.Error("Delete() accepted an invalid version")
+	}
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"expvar"
+	"math/rand/v2"
+	"time"
+)
+
+// metrics counts the hits and misses of every cache tier.
+var metrics = new(expvar.Map)
+
+// Metrics returns the cache counters, to be published with expvar.
+func Metrics() expvar.Var {
+	return metrics
+}
+
+// jitter spreads ttl by up to 10% either way, so that entries cached together
+// do not all expire together.
+func jitter(ttl time.Duration) time.Duration {
+	spread := int64(ttl / 10)
+
+	if spread <= 0 {
+		return ttl
+	}
+
+	return ttl - time.Duration(spread) + time.Duration(rand.Int64N(2*spread+1))
+}
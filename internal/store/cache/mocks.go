@@ -10,6 +10,7 @@ import (
 func NewMockCache() Storage {
 	return Storage{
 		Users: &MockCacheStorage{},
+		Posts: &MockPostCache{},
 	}
 }
 
@@ -17,10 +18,47 @@ type MockCacheStorage struct {
 	mock.Mock
 }
 
-func (m *MockCacheStorage) Get(ctx context.Context, id int64) (*store.User, error) {
+func (m *MockCacheStorage) Get(ctx context.Context, id int64) (*store.User, bool, error) {
 	args := m.Called(id)
-	return &store.User{}, args.Error(1)
+	return &store.User{}, false, args.Error(1)
 }
-func (m *MockCacheStorage) Set(context.Context, *store.User) error {
+func (m *MockCacheStorage) Generation(context.Context, int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockCacheStorage) Set(context.Context, *store.User, int64) error {
+	return nil
+}
+
+func (m *MockCacheStorage) Delete(context.Context, int64) error {
+	return nil
+}
+
+// MockPostCache always misses.
+type MockPostCache struct {
+	mock.Mock
+}
+
+func (m *MockPostCache) Get(ctx context.Context, id int64) (*store.Post, error) {
+	return nil, nil
+}
+
+func (m *MockPostCache) MGet(ctx context.Context, ids []int64) (map[int64]*store.Post, error) {
+	return map[int64]*store.Post{}, nil
+}
+
+func (m *MockPostCache) Generation(context.Context, int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockPostCache) Set(context.Context, *store.Post, int64) error {
+	return nil
+}
+
+func (m *MockPostCache) SetNotFound(context.Context, int64) error {
+	return nil
+}
+
+func (m *MockPostCache) Delete(context.Context, int64, string) error {
 	return nil
 }
@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rpstvs/social/internal/store"
+)
+
+const (
+	postTTL         = time.Hour
+	postNotFoundTTL = time.Minute
+)
+
+// Each post is stored under a key carrying its version, pointed at by
+// "post-<id>". The pointer holds the current version, or is empty for a post
+// known not to exist.
+func postKey(id int64) string {
+	return fmt.Sprintf("post-%d", id)
+}
+
+func postVersionKey(id int64, version string) string {
+	return fmt.Sprintf("post-%d-v%s", id, version)
+}
+
+// Each invalidation of a post also bumps its generation, kept in
+// "post-<id>-gen": some writes, like reposts, change a post without changing
+// its version.
+func postGenerationKey(id int64) string {
+	return fmt.Sprintf("post-%d-gen", id)
+}
+
+// getPostScript follows the pointer of a post in a single round trip. It
+// returns {0} on a miss, {1} for a post known not to exist and {2, data}
+// otherwise.
+var getPostScript = redis.NewScript(`
+local version = redis.call('GET', KEYS[1])
+if not version then
+	return {0}
+end
+if version == '' then
+	return {1}
+end
+local data = redis.call('GET', KEYS[1] .. '-v' .. version)
+if not data then
+	return {0}
+end
+return {2, data}
+`)
+
+// setPostScript stores a version of a post unless the pointer is at a newer
+// version or marks the post as missing, or the post was invalidated since
+// the generation read before loading it, so a slow reader cannot bring back
+// a stale post after a write.
+var setPostScript = redis.NewScript(`
+local generation = redis.call('GET', KEYS[2]) or '0'
+if generation ~= ARGV[4] then
+	return 0
+end
+local current = redis.call('GET', KEYS[1])
+if current and (current == '' or tonumber(current) > tonumber(ARGV[1])) then
+	return 0
+end
+redis.call('SET', KEYS[1] .. '-v' .. ARGV[1], ARGV[2], 'EX', ARGV[3])
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[3])
+return 1
+`)
+
+// deletePostScript bumps the generation of the post and moves the pointer to
+// a version without data, unless it is already at a newer one.
+var deletePostScript = redis.NewScript(`
+redis.call('INCR', KEYS[2])
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+local current = redis.call('GET', KEYS[1])
+if current and current ~= '' and tonumber(current) > tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[1] .. '-v' .. ARGV[1])
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return 1
+`)
+
+type PostStore struct {
+	rdb *redis.Client
+}
+
+// Get returns the cached post, nil on a miss or store.ErrNotFound for a post
+// known not to exist.
+func (s *PostStore) Get(ctx context.Context, id int64) (*store.Post, error) {
+	res, err := getPostScript.Run(ctx, s.rdb, []string{postKey(id)}).Slice()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch res[0].(int64) {
+	case 0:
+		metrics.Add("posts_misses", 1)
+		return nil, nil
+	case 1:
+		metrics.Add("posts_not_found_hits", 1)
+		return nil, store.ErrNotFound
+	}
+
+	metrics.Add("posts_hits", 1)
+
+	var post store.Post
+
+	if err := json.Unmarshal([]byte(res[1].(string)), &post); err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+// MGet returns the cached posts among ids, keyed by ID. Misses and posts
+// known not to exist are left out.
+func (s *PostStore) MGet(ctx context.Context, ids []int64) (map[int64]*store.Post, error) {
+	posts := make(map[int64]*store.Post, len(ids))
+
+	if len(ids) == 0 {
+		return posts, nil
+	}
+
+	keys := make([]string, len(ids))
+
+	for i, id := range ids {
+		keys[i] = postKey(id)
+	}
+
+	versions, err := s.rdb.MGet(ctx, keys...).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var found []int64
+
+	keys = keys[:0]
+
+	for i, v := range versions {
+		if version, ok := v.(string); ok && version != "" {
+			found = append(found, ids[i])
+			keys = append(keys, postVersionKey(ids[i], version))
+		}
+	}
+
+	if len(keys) == 0 {
+		metrics.Add("posts_misses", int64(len(ids)))
+		return posts, nil
+	}
+
+	data, err := s.rdb.MGet(ctx, keys...).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, d := range data {
+		raw, ok := d.(string)
+
+		if !ok {
+			continue
+		}
+
+		var post store.Post
+
+		if err := json.Unmarshal([]byte(raw), &post); err != nil {
+			return nil, err
+		}
+
+		posts[found[i]] = &post
+	}
+
+	metrics.Add("posts_hits", int64(len(posts)))
+	metrics.Add("posts_misses", int64(len(ids)-len(posts)))
+
+	return posts, nil
+}
+
+// Generation returns the generation of the post, to be read before loading
+// it and given to Set.
+func (s *PostStore) Generation(ctx context.Context, id int64) (int64, error) {
+	generation, err := s.rdb.Get(ctx, postGenerationKey(id)).Int64()
+
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return generation, err
+}
+
+// Set caches the post, loaded after reading its generation. Nothing is
+// cached when the post was invalidated since.
+func (s *PostStore) Set(ctx context.Context, post *store.Post, generation int64) error {
+	if _, err := strconv.Atoi(post.Version); err != nil {
+		return fmt.Errorf("post %d has an invalid version %q", post.ID, post.Version)
+	}
+
+	data, err := json.Marshal(post)
+
+	if err != nil {
+		return err
+	}
+
+	keys := []string{postKey(post.ID), postGenerationKey(post.ID)}
+
+	return setPostScript.Run(ctx, s.rdb, keys, post.Version, data, int(jitter(postTTL).Seconds()), generation).Err()
+}
+
+// SetNotFound remembers for a short while that the post does not exist.
+// Until then the post cannot be cached.
+func (s *PostStore) SetNotFound(ctx context.Context, id int64) error {
+	return s.rdb.Set(ctx, postKey(id), "", postNotFoundTTL).Err()
+}
+
+// Delete invalidates the post as of the given version, which is what it is
+// after the write: reads miss until the post is cached again, and older
+// versions, or posts loaded before, cannot be. It also lifts SetNotFound.
+func (s *PostStore) Delete(ctx context.Context, id int64, version string) error {
+	if _, err := strconv.Atoi(version); err != nil {
+		return fmt.Errorf("post %d has an invalid version %q", id, version)
+	}
+
+	keys := []string{postKey(id), postGenerationKey(id)}
+
+	return deletePostScript.Run(ctx, s.rdb, keys, version, int(postTTL.Seconds())).Err()
+}
@@ -2,20 +2,48 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rpstvs/social/internal/store"
 )
 
 type Storage struct {
+	// Users.Get returns nil on a miss. A stale user can still be served but
+	// should be refreshed. Users are loaded after reading their generation,
+	// which Set checks: it fails with ErrStale when they were deleted since.
 	Users interface {
-		Get(context.Context, int64) (*store.User, error)
-		Set(context.Context, *store.User) error
+		Get(context.Context, int64) (*store.User, bool, error)
+		Generation(context.Context, int64) (int64, error)
+		Set(ctx context.Context, user *store.User, generation int64) error
+		Delete(context.Context, int64) error
+	}
+	// Posts only holds posts that read the same for every viewer. Like
+	// users, posts are loaded after reading their generation, which Set
+	// checks.
+	Posts interface {
+		Get(context.Context, int64) (*store.Post, error)
+		MGet(context.Context, []int64) (map[int64]*store.Post, error)
+		Generation(context.Context, int64) (int64, error)
+		Set(ctx context.Context, post *store.Post, generation int64) error
+		SetNotFound(context.Context, int64) error
+		Delete(ctx context.Context, id int64, version string) error
 	}
 }
 
-func NewRedisStorage(rdb *redis.Client) Storage {
-	return Storage{
-		Users: &UserStore{rdb: rdb},
+// NewRedisStorage caches in redis, with up to localSize users also kept in
+// process for localTTL. A localSize of zero disables the in-process tier.
+func NewRedisStorage(rdb *redis.Client, localSize int, localTTL time.Duration) Storage {
+	users := &UserStore{rdb: rdb}
+
+	storage := Storage{
+		Users: users,
+		Posts: &PostStore{rdb: rdb},
 	}
+
+	if localSize > 0 {
+		storage.Users = NewTieredUserStore(users, localSize, localTTL)
+	}
+
+	return storage
 }
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+// sharedUserCache is a user cache shared by every instance, notifying them
+// of the users deleted from it.
+type sharedUserCache interface {
+	Get(context.Context, int64) (*store.User, bool, error)
+	Generation(context.Context, int64) (int64, error)
+	Set(ctx context.Context, user *store.User, generation int64) error
+	Delete(context.Context, int64) error
+	Subscribe(ctx context.Context, evict func(int64)) error
+}
+
+// Listener is implemented by the caches keeping data in process, which must
+// listen for the invalidations made by other instances.
+type Listener interface {
+	// Listen applies the invalidations of other instances until ctx is
+	// cancelled.
+	Listen(ctx context.Context) error
+}
+
+// TieredUserStore keeps the users recently read from the next tier in
+// process for a short while, saving a round trip to redis on every
+// authenticated request. Stale users are not kept.
+type TieredUserStore struct {
+	local *lru[int64, store.User]
+	next  sharedUserCache
+	ttl   time.Duration
+}
+
+// NewTieredUserStore puts an in-process tier of up to size users, each kept
+// for ttl, in front of next. The ttl bounds how long a user invalidated by
+// another instance can be served when the notification is missed.
+func NewTieredUserStore(next sharedUserCache, size int, ttl time.Duration) *TieredUserStore {
+	return &TieredUserStore{
+		local: newLRU[int64, store.User]("users_local", size),
+		next:  next,
+		ttl:   ttl,
+	}
+}
+
+func (s *TieredUserStore) Get(ctx context.Context, id int64) (*store.User, bool, error) {
+	if user, ok := s.local.Get(id); ok {
+		metrics.Add("users_local_hits", 1)
+		return &user, false, nil
+	}
+
+	user, stale, err := s.next.Get(ctx, id)
+
+	if err != nil || user == nil {
+		return user, stale, err
+	}
+
+	if !stale {
+		s.local.Set(id, *user, jitter(s.ttl))
+	}
+
+	return user, stale, nil
+}
+
+func (s *TieredUserStore) Generation(ctx context.Context, id int64) (int64, error) {
+	return s.next.Generation(ctx, id)
+}
+
+// Set checks the generation again once the user is kept in process: a
+// deletion running meanwhile may have evicted them from the local tier
+// before they were added to it.
+func (s *TieredUserStore) Set(ctx context.Context, user *store.User, generation int64) error {
+	if err := s.next.Set(ctx, user, generation); err != nil {
+		return err
+	}
+
+	s.local.Set(user.ID, *user, jitter(s.ttl))
+
+	current, err := s.next.Generation(ctx, user.ID)
+
+	if err != nil || current != generation {
+		s.local.Delete(user.ID)
+	}
+
+	return err
+}
+
+// Delete bumps the generation before evicting the local copy, so that Set
+// notices it.
+func (s *TieredUserStore) Delete(ctx context.Context, id int64) error {
+	err := s.next.Delete(ctx, id)
+
+	s.local.Delete(id)
+
+	return err
+}
+
+func (s *TieredUserStore) Listen(ctx context.Context) error {
+	return s.next.Subscribe(ctx, s.local.Delete)
+}
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rpstvs/social/internal/store"
+)
+
+// fakeSharedUsers is an in-process shared tier. stale makes every user read
+// from it stale, and beforeGeneration, when set, runs once on the next
+// Generation call, standing for an invalidation by another instance.
+type fakeSharedUsers struct {
+	*MemoryUserStore
+	stale            bool
+	beforeGeneration func()
+	evict            func(int64)
+}
+
+func (f *fakeSharedUsers) Get(ctx context.Context, id int64) (*store.User, bool, error) {
+	user, stale, err := f.MemoryUserStore.Get(ctx, id)
+
+	return user, stale || f.stale, err
+}
+
+func (f *fakeSharedUsers) Generation(ctx context.Context, id int64) (int64, error) {
+	if hook := f.beforeGeneration; hook != nil {
+		f.beforeGeneration = nil
+		hook()
+	}
+
+	return f.MemoryUserStore.Generation(ctx, id)
+}
+
+func (f *fakeSharedUsers) Subscribe(ctx context.Context, evict func(int64)) error {
+	f.evict = evict
+	return nil
+}
+
+func newTestTiered(t *testing.T) (*TieredUserStore, *fakeSharedUsers, *time.Time) {
+	t.Helper()
+
+	shared := &fakeSharedUsers{MemoryUserStore: NewMemoryStorage(10).Users.(*MemoryUserStore)}
+	s := NewTieredUserStore(shared, 10, time.Minute)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	s.local.now = func() time.Time { return now }
+
+	return s, shared, &now
+}
+
+// cacheUser sets user in s the way the API does, from the generation read
+// before loading them.
+func cacheUser(t *testing.T, s *TieredUserStore, user *store.User) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	generation, err := s.Generation(ctx, user.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(ctx, user, generation); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTieredUserStoreDelete(t *testing.T) {
+	s, _, _ := newTestTiered(t)
+	ctx := context.Background()
+
+	cacheUser(t, s, &store.User{ID: 1, Username: "alice"})
+
+	if err := s.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, _, err := s.Get(ctx, 1); err != nil || user != nil {
+		t.Errorf("Get() = %+v, %v after Delete, want a miss", user, err)
+	}
+}
+
+func TestTieredUserStoreListen(t *testing.T) {
+	s, shared, now := newTestTiered(t)
+	ctx := context.Background()
+
+	cacheUser(t, s, &store.User{ID: 1, Username: "alice"})
+
+	if err := s.Listen(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// another instance invalidates the user
+	if err := shared.MemoryUserStore.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// until the notification arrives, the local copy is served within its TTL
+	if user, _, _ := s.Get(ctx, 1); user == nil {
+		t.Fatal("Get() missed the local copy before the notification")
+	}
+
+	shared.evict(1)
+
+	if user, _, _ := s.Get(ctx, 1); user != nil {
+		t.Errorf("Get() = %+v after the notification, want a miss", user)
+	}
+
+	// a missed notification is bounded by the local TTL
+	cacheUser(t, s, &store.User{ID: 2, Username: "bob"})
+
+	if err := shared.MemoryUserStore.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	*now = now.Add(2 * time.Minute)
+
+	if user, _, _ := s.Get(ctx, 2); user != nil {
+		t.Errorf("Get() = %+v past the local TTL, want a miss", user)
+	}
+}
+
+func TestTieredUserStoreSetRacingDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		// race invalidates the user while it is being cached
+		race    func(s *TieredUserStore, shared *fakeSharedUsers, generation int64) error
+		wantErr error
+	}{
+		{
+			name: "deleted before Set",
+			race: func(s *TieredUserStore, shared *fakeSharedUsers, generation int64) error {
+				if err := s.Delete(context.Background(), 1); err != nil {
+					return err
+				}
+
+				return s.Set(context.Background(), &store.User{ID: 1}, generation)
+			},
+			wantErr: ErrStale,
+		},
+		{
+			name: "deleted between the shared and the local write",
+			race: func(s *TieredUserStore, shared *fakeSharedUsers, generation int64) error {
+				shared.beforeGeneration = func() { s.Delete(context.Background(), 1) }
+
+				return s.Set(context.Background(), &store.User{ID: 1}, generation)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, shared, _ := newTestTiered(t)
+			ctx := context.Background()
+
+			generation, err := s.Generation(ctx, 1)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.race(s, shared, generation); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Set() err = %v, want %v", err, tt.wantErr)
+			}
+
+			if _, ok := s.local.Get(1); ok {
+				t.Error("the user was kept in process after being invalidated")
+			}
+
+			if user, _, _ := s.Get(ctx, 1); user != nil {
+				t.Errorf("Get() = %+v, want a miss", user)
+			}
+		})
+	}
+}
+
+func TestTieredUserStoreSkipsStale(t *testing.T) {
+	s, shared, _ := newTestTiered(t)
+	ctx := context.Background()
+
+	cacheUser(t, s, &store.User{ID: 1, Username: "alice"})
+	s.local.Delete(1)
+	shared.stale = true
+
+	user, stale, err := s.Get(ctx, 1)
+
+	if err != nil || user == nil || !stale {
+		t.Fatalf("Get() = %+v, %v, %v, want the stale user", user, stale, err)
+	}
+
+	if _, ok := s.local.Get(1); ok {
+		t.Error("a stale user was kept in process")
+	}
+}
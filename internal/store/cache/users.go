@@ -3,50 +3,169 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/rpstvs/social/internal/store"
 )
 
+const (
+	// userTTL is how long a cached user is fresh for. It is then served
+	// stale for up to userStaleTTL while it is refreshed.
+	userTTL      = time.Hour
+	userStaleTTL = 10 * time.Minute
+)
+
+// ErrStale is returned by Set when the user was deleted from the cache since
+// the generation the caller read: the user it loaded may predate the change.
+var ErrStale = errors.New("user changed while it was loaded")
+
+// Each deletion of a user bumps their generation, kept in "user-gen-<id>"
+// for as long as a load started before it could still be running.
+func userKey(id int64) string {
+	return fmt.Sprintf("user-%v", id)
+}
+
+func userGenerationKey(id int64) string {
+	return fmt.Sprintf("user-gen-%v", id)
+}
+
+// setUserScript caches a user unless their generation moved on.
+var setUserScript = redis.NewScript(`
+local generation = redis.call('GET', KEYS[2]) or '0'
+if generation ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// userInvalidations is the channel the IDs of the users deleted from the
+// cache are published on, for the instances keeping users in process.
+const userInvalidations = "user-invalidations"
+
 type UserStore struct {
 	rdb *redis.Client
 }
 
-func (u *UserStore) Get(ctx context.Context, id int64) (*store.User, error) {
-	cacheKey := fmt.Sprintf("user-%v", id)
+// Get returns the cached user, or nil on a miss. A stale user has outlived
+// userTTL and should be refreshed.
+func (u *UserStore) Get(ctx context.Context, id int64) (*store.User, bool, error) {
+	cacheKey := userKey(id)
+
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
 
-	data, err := u.rdb.Get(ctx, cacheKey).Result()
+	_, err := u.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, cacheKey)
+		ttl = pipe.PTTL(ctx, cacheKey)
+		return nil
+	})
 
 	if err == redis.Nil {
-		return nil, nil
+		metrics.Add("users_misses", 1)
+		return nil, false, nil
 	} else if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	var user store.User
 
-	if data != "" {
-		err := json.Unmarshal([]byte(data), &user)
+	if err := json.Unmarshal([]byte(get.Val()), &user); err != nil {
+		return nil, false, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	stale := ttl.Val() <= userStaleTTL
+
+	if stale {
+		metrics.Add("users_stale_hits", 1)
+	} else {
+		metrics.Add("users_hits", 1)
 	}
 
-	return &user, nil
+	return &user, stale, nil
 }
 
-func (u *UserStore) Set(ctx context.Context, user *store.User) error {
+// Generation returns the generation of the user, to be read before loading
+// them and given to Set.
+func (u *UserStore) Generation(ctx context.Context, id int64) (int64, error) {
+	generation, err := u.rdb.Get(ctx, userGenerationKey(id)).Int64()
 
-	cacheKey := fmt.Sprintf("user-%v", user.ID)
+	if err == redis.Nil {
+		return 0, nil
+	}
 
+	return generation, err
+}
+
+// Set caches the user, loaded after reading their generation. ErrStale is
+// returned, and nothing cached, when they were deleted since.
+func (u *UserStore) Set(ctx context.Context, user *store.User, generation int64) error {
 	data, err := json.Marshal(user)
 
 	if err != nil {
 		return err
 	}
 
-	return u.rdb.Set(ctx, cacheKey, data, 24*time.Hour).Err()
+	ttl := jitter(userTTL) + userStaleTTL
+	keys := []string{userKey(user.ID), userGenerationKey(user.ID)}
+
+	set, err := setUserScript.Run(ctx, u.rdb, keys, generation, data, ttl.Milliseconds()).Bool()
+
+	if err != nil {
+		return err
+	}
+
+	if !set {
+		return ErrStale
+	}
+
+	return nil
+}
+
+// Delete removes the user from the cache, bumping their generation so that
+// loads already running do not cache them again, and tells every instance
+// about it.
+func (u *UserStore) Delete(ctx context.Context, id int64) error {
+	_, err := u.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, userGenerationKey(id))
+		pipe.Expire(ctx, userGenerationKey(id), userTTL)
+		pipe.Del(ctx, userKey(id))
+		pipe.Publish(ctx, userInvalidations, id)
+		return nil
+	})
+
+	return err
+}
+
+// Subscribe calls evict with the ID of every user deleted from the cache,
+// by any instance, until ctx is cancelled. Deletions published while the
+// subscription reconnects are missed.
+func (u *UserStore) Subscribe(ctx context.Context, evict func(int64)) error {
+	sub := u.rdb.Subscribe(ctx, userInvalidations)
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := sub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			if id, err := strconv.ParseInt(msg.Payload, 10, 64); err == nil {
+				evict(id)
+			}
+		}
+	}
 }
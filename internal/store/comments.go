@@ -23,9 +23,9 @@ func (s *CommentsStore) GetById(ctx context.Context, postid int64) (*[]Comment,
 
 	query := `
 	SELECT c.id, c.post_id, c.content, c.created_at, users.username, users.id from comments c
-	JOIN users on users.id = comments.user_id
-	WHERE comments.post_id = $1
-	ORDER BY comments.created_at DESC`
+	JOIN users on users.id = c.user_id
+	WHERE c.post_id = $1
+	ORDER BY c.created_at DESC`
 
 	sqlRows, err := s.db.QueryContext(ctx, query, postid)
 
@@ -51,6 +51,55 @@ func (s *CommentsStore) GetById(ctx context.Context, postid int64) (*[]Comment,
 	return &Comments, nil
 }
 
+// GetByPost pages through the comments of a post, oldest first by default.
+func (s *CommentsStore) GetByPost(ctx context.Context, postID int64, fq PaginatedFeedQuery) ([]Comment, Page, error) {
+	ks := fq.keysetClause("c.created_at", "c.id", 4)
+
+	query := `
+	SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username
+	FROM comments c
+	JOIN users u ON u.id = c.user_id
+	WHERE c.post_id = $1 AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	args := append([]any{postID, fq.Limit + 1, ks.offset}, ks.args...)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	defer rows.Close()
+
+	comments := []Comment{}
+
+	for rows.Next() {
+		var c Comment
+
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.Created_at, &c.User.Username); err != nil {
+			return nil, Page{}, err
+		}
+
+		c.User.ID = c.UserID
+		comments = append(comments, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	comments, page := Paginate(comments, fq, func(c Comment) (string, int64) {
+		return c.Created_at, c.ID
+	})
+
+	return comments, page, nil
+}
+
 func (s *CommentsStore) Create(ctx context.Context, comment *Comment) error {
 	query := `
 	INSERT INTO comments (post_id, user_id, content)
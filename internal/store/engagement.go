@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of events weighed by the trending rankings.
+const (
+	EngagementComment  = "comment"
+	EngagementRepost   = "repost"
+	EngagementQuote    = "quote"
+	EngagementBookmark = "bookmark"
+	EngagementVote     = "vote"
+	EngagementTagUse   = "post"
+)
+
+type EngagementStore struct {
+	db *sql.DB
+}
+
+// TrendingQuery scores the events of the last Span before Now. An event
+// HalfLife old weighs half as much as one happening at Now, times the weight
+// of its kind; kinds missing from Weights are ignored. Each user counts once
+// per item and kind, with their earliest event, and items need MinUsers
+// distinct users to rank at all.
+type TrendingQuery struct {
+	Now      time.Time
+	Span     time.Duration
+	HalfLife time.Duration
+	Weights  map[string]float64
+	MinUsers int
+	Limit    int
+}
+
+// TrendingScore is the score of a post ID or a tag name.
+type TrendingScore struct {
+	ID    string
+	Score float64
+}
+
+// GetTrendingPosts ranks the public published posts by the interactions of
+// users other than their author. Bookmarks stand in for reactions; they are
+// never exposed individually.
+func (s *EngagementStore) GetTrendingPosts(ctx context.Context, q TrendingQuery) ([]TrendingScore, error) {
+	events := `
+	SELECT e.post_id::text AS item, e.user_id, e.kind, e.at
+	FROM (
+		SELECT post_id, user_id, 'comment' AS kind, created_at AS at
+		FROM comments WHERE created_at > $1
+		UNION ALL
+		SELECT repost_of_id, user_id, CASE WHEN is_repost THEN 'repost' ELSE 'quote' END, created_at
+		FROM posts WHERE repost_of_id IS NOT NULL AND deleted_at IS NULL AND created_at > $1
+		UNION ALL
+		SELECT post_id, user_id, 'bookmark', created_at
+		FROM bookmarks WHERE created_at > $1
+		UNION ALL
+		SELECT pl.post_id, v.user_id, 'vote', v.created_at
+		FROM poll_voters v JOIN polls pl ON pl.id = v.poll_id WHERE v.created_at > $1
+	) e
+	JOIN posts p ON p.id = e.post_id
+	WHERE p.visibility = 'public' AND p.status = 'published' AND p.deleted_at IS NULL
+		AND e.user_id <> p.user_id`
+
+	return s.rankTrending(ctx, events, q)
+}
+
+// GetTrendingTags ranks the tags by their use in public posts published in
+// the span, each author counting as a user of the tag.
+func (s *EngagementStore) GetTrendingTags(ctx context.Context, q TrendingQuery) ([]TrendingScore, error) {
+	events := `
+	SELECT t AS item, p.user_id, '` + EngagementTagUse + `' AS kind, p.published_at AS at
+	FROM posts p, unnest(p.tags) t
+	WHERE p.published_at > $1 AND p.visibility = 'public' AND p.status = 'published' AND p.deleted_at IS NULL`
+
+	return s.rankTrending(ctx, events, q)
+}
+
+// rankTrending aggregates the events selected by the events query, which
+// yields item, user_id, kind and at columns and filters on at > $1, into the
+// top scores of the query.
+func (s *EngagementStore) rankTrending(ctx context.Context, events string, q TrendingQuery) ([]TrendingScore, error) {
+	query := `
+	WITH weights AS (
+		SELECT * FROM unnest($3::text[], $4::float8[]) AS w(kind, weight)
+	), firsts AS (
+		SELECT e.item, e.user_id, e.kind, MIN(e.at) AS at
+		FROM (` + events + `) e
+		GROUP BY e.item, e.user_id, e.kind
+	)
+	SELECT f.item,
+		SUM(w.weight * power(2, -GREATEST(EXTRACT(EPOCH FROM $2::timestamptz - f.at)::float8, 0) / $5::float8)) AS score
+	FROM firsts f
+	JOIN weights w ON w.kind = f.kind
+	GROUP BY f.item
+	HAVING COUNT(DISTINCT f.user_id) >= $6
+	ORDER BY score DESC, f.item COLLATE "C"
+	LIMIT $7`
+
+	kinds := make([]string, 0, len(q.Weights))
+	weights := make([]float64, 0, len(q.Weights))
+
+	for kind, weight := range q.Weights {
+		kinds = append(kinds, kind)
+		weights = append(weights, weight)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Now.Add(-q.Span), q.Now, pq.Array(kinds), pq.Array(weights),
+		q.HalfLife.Seconds(), q.MinUsers, q.Limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var scores []TrendingScore
+
+	for rows.Next() {
+		var ts TrendingScore
+
+		if err := rows.Scan(&ts.ID, &ts.Score); err != nil {
+			return nil, err
+		}
+
+		scores = append(scores, ts)
+	}
+
+	return scores, rows.Err()
+}
+
+// RankingCandidate is a post the user may see in their ranked feed, with its
+// engagement and the user's affinity with its author.
+type RankingCandidate struct {
+	PostID   int64
+	AuthorID int64
+	At       time.Time
+	// Source is "followed", "tag" or "network", the first that applies.
+	Source       string
+	Comments     int
+	Reposts      int
+	Bookmarks    int
+	Votes        int
+	Interactions int
+}
+
+// GetRankingCandidates returns up to limit of the most recent posts published
+// between since and until that the user can read and did not write: the
+// posts of the accounts they follow, of the tags they follow and the public
+// posts of the accounts followed by the accounts they follow, narrowed down
+// by the search, tags, since and until filters of fq. Plain reposts are left
+// out. Interactions count the comments, reposts and bookmarks of the user on
+// posts of the author over the 30 days before until. Only the engagement up
+// to until is counted, so the same until yields the same candidates.
+func (s *EngagementStore) GetRankingCandidates(ctx context.Context, userID int64, since, until time.Time, fq PaginatedFeedQuery, limit int) ([]RankingCandidate, error) {
+	query := `
+	WITH followed AS (
+		SELECT user_id FROM followers WHERE follower_id = $1
+	), network AS (
+		SELECT DISTINCT f.user_id FROM followers f
+		WHERE f.follower_id IN (SELECT user_id FROM followed)
+			AND f.user_id <> $1 AND f.user_id NOT IN (SELECT user_id FROM followed)
+	), candidates AS (
+		SELECT p.id, p.user_id, p.published_at,
+			CASE
+				WHEN p.user_id IN (SELECT user_id FROM followed) THEN 'followed'
+				WHEN p.tags && ARRAY(SELECT tag FROM tag_follows WHERE user_id = $1) THEN 'tag'
+				ELSE 'network'
+			END AS source
+		FROM posts p
+		JOIN users u ON u.id = p.user_id AND u.is_active = true
+		WHERE p.published_at > $2 AND p.published_at <= $3 AND NOT p.is_repost AND p.user_id <> $1
+			AND ` + visibleTo("p", "$1") + `
+			AND (p.user_id IN (SELECT user_id FROM followed)
+				OR p.tags && ARRAY(SELECT tag FROM tag_follows WHERE user_id = $1)
+				OR (p.visibility = 'public' AND p.user_id IN (SELECT user_id FROM network)))
+			AND ($5 = '' OR p.search_vector @@ websearch_to_tsquery('` + searchConfig + `', $5))
+			AND (COALESCE(cardinality($6::text[]), 0) = 0 OR p.tags @> $6)
+			AND ($7::text = '' OR p.published_at >= NULLIF($7::text, '')::timestamptz)
+			AND ($8::text = '' OR p.published_at <= NULLIF($8::text, '')::timestamptz)
+		ORDER BY p.published_at DESC, p.id DESC
+		LIMIT $4
+	), comment_counts AS (
+		SELECT post_id, COUNT(*) AS n FROM comments
+		WHERE post_id IN (SELECT id FROM candidates) AND created_at <= $3
+		GROUP BY post_id
+	), repost_counts AS (
+		SELECT repost_of_id AS post_id, COUNT(*) AS n FROM posts
+		WHERE repost_of_id IN (SELECT id FROM candidates) AND deleted_at IS NULL AND created_at <= $3
+		GROUP BY repost_of_id
+	), bookmark_counts AS (
+		SELECT post_id, COUNT(*) AS n FROM bookmarks
+		WHERE post_id IN (SELECT id FROM candidates) AND created_at <= $3
+		GROUP BY post_id
+	), vote_counts AS (
+		SELECT pl.post_id, COUNT(*) AS n FROM poll_voters v
+		JOIN polls pl ON pl.id = v.poll_id
+		WHERE pl.post_id IN (SELECT id FROM candidates) AND v.created_at <= $3
+		GROUP BY pl.post_id
+	), affinity AS (
+		SELECT ap.user_id, COUNT(*) AS n
+		FROM (
+			SELECT post_id FROM comments
+			WHERE user_id = $1 AND created_at > $3::timestamptz - INTERVAL '30 days' AND created_at <= $3
+			UNION ALL
+			SELECT repost_of_id FROM posts
+			WHERE user_id = $1 AND repost_of_id IS NOT NULL AND deleted_at IS NULL
+				AND created_at > $3::timestamptz - INTERVAL '30 days' AND created_at <= $3
+			UNION ALL
+			SELECT post_id FROM bookmarks
+			WHERE user_id = $1 AND created_at > $3::timestamptz - INTERVAL '30 days' AND created_at <= $3
+		) i
+		JOIN posts ap ON ap.id = i.post_id
+		WHERE ap.user_id IN (SELECT user_id FROM candidates)
+		GROUP BY ap.user_id
+	)
+	SELECT c.id, c.user_id, c.published_at, c.source,
+		COALESCE(cc.n, 0), COALESCE(rc.n, 0), COALESCE(bc.n, 0), COALESCE(vc.n, 0), COALESCE(a.n, 0)
+	FROM candidates c
+	LEFT JOIN comment_counts cc ON cc.post_id = c.id
+	LEFT JOIN repost_counts rc ON rc.post_id = c.id
+	LEFT JOIN bookmark_counts bc ON bc.post_id = c.id
+	LEFT JOIN vote_counts vc ON vc.post_id = c.id
+	LEFT JOIN affinity a ON a.user_id = c.user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since, until, limit, fq.Search, pq.Array(fq.Tags), fq.Since, fq.Until)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var candidates []RankingCandidate
+
+	for rows.Next() {
+		var c RankingCandidate
+
+		err := rows.Scan(&c.PostID, &c.AuthorID, &c.At, &c.Source, &c.Comments, &c.Reposts, &c.Bookmarks, &c.Votes, &c.Interactions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, rows.Err()
+}
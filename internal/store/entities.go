@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rpstvs/social/internal/entities"
+)
+
+// PostEntity is a mention or hashtag found in the content of a post. Start
+// and End are byte offsets into the content, sigil included. Mentions are
+// only kept when they resolve to a user.
+type PostEntity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Text   string `json:"text"`
+	UserID *int64 `json:"user_id,omitempty"`
+}
+
+// extractEntities parses the content of the post, resolving mentions to
+// users. Mentioned users are added to Mentions and hashtags to Tags, which
+// end up normalized.
+func extractEntities(ctx context.Context, tx *sql.Tx, post *Post) error {
+	found := entities.Parse(post.Content)
+	usernames := entities.Texts(found, entities.Mention)
+
+	users, err := resolveUsernames(ctx, tx, usernames)
+
+	if err != nil {
+		return err
+	}
+
+	post.Entities = nil
+
+	for _, e := range found {
+		entity := PostEntity{Type: e.Type, Start: e.Start, End: e.End, Text: e.Text}
+
+		if e.Type == entities.Mention {
+			id, ok := users[strings.ToLower(e.Text)]
+
+			if !ok {
+				continue
+			}
+
+			entity.UserID = &id
+
+			if !slices.Contains(post.Mentions, id) {
+				post.Mentions = append(post.Mentions, id)
+			}
+		}
+
+		post.Entities = append(post.Entities, entity)
+	}
+
+	post.Tags = entities.NormalizeTags(append(post.Tags, entities.Texts(found, entities.Hashtag)...))
+
+	return nil
+}
+
+// stripEntities removes from Mentions and Tags what a previous extraction
+// added, so that editing a mention or hashtag out of the content drops it.
+func stripEntities(ctx context.Context, tx *sql.Tx, post *Post) error {
+	previous, err := getEntities(ctx, tx, []int64{post.ID})
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range previous[post.ID] {
+		switch e.Type {
+		case entities.Mention:
+			post.Mentions = slices.DeleteFunc(post.Mentions, func(id int64) bool {
+				return e.UserID != nil && id == *e.UserID
+			})
+		case entities.Hashtag:
+			post.Tags = slices.DeleteFunc(post.Tags, func(tag string) bool {
+				return tag == entities.NormalizeTag(e.Text)
+			})
+		}
+	}
+
+	return nil
+}
+
+// resolveUsernames maps the lower-cased usernames to active user IDs,
+// matching case-insensitively.
+func resolveUsernames(ctx context.Context, tx *sql.Tx, usernames []string) (map[string]int64, error) {
+	users := make(map[string]int64)
+
+	if len(usernames) == 0 {
+		return users, nil
+	}
+
+	lowered := make([]string, len(usernames))
+
+	for i, u := range usernames {
+		lowered[i] = strings.ToLower(u)
+	}
+
+	query := `
+	SELECT DISTINCT ON (lower(username)) id, lower(username)
+	FROM users
+	WHERE lower(username) = ANY($1) AND is_active = true
+	ORDER BY lower(username), id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(lowered))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id       int64
+			username string
+		)
+
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+
+		users[username] = id
+	}
+
+	return users, rows.Err()
+}
+
+func saveEntities(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `
+	DELETE FROM post_entities
+	WHERE post_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, query, post.ID); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO post_entities (post_id, type, start_offset, end_offset, text, user_id)
+	VALUES($1,$2,$3,$4,$5,$6)`
+
+	for _, e := range post.Entities {
+		if _, err := tx.ExecContext(ctx, query, post.ID, e.Type, e.Start, e.End, e.Text, e.UserID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getEntities loads the entities of several posts at once, keyed by post ID
+// and ordered by offset.
+func getEntities(ctx context.Context, q queryer, postIDs []int64) (map[int64][]PostEntity, error) {
+	query := `
+	SELECT post_id, type, start_offset, end_offset, text, user_id
+	FROM post_entities
+	WHERE post_id = ANY($1)
+	ORDER BY post_id, start_offset`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := q.QueryContext(ctx, query, pq.Array(postIDs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	found := make(map[int64][]PostEntity)
+
+	for rows.Next() {
+		var (
+			postID int64
+			e      PostEntity
+		)
+
+		if err := rows.Scan(&postID, &e.Type, &e.Start, &e.End, &e.Text, &e.UserID); err != nil {
+			return nil, err
+		}
+
+		found[postID] = append(found[postID], e)
+	}
+
+	return found, rows.Err()
+}
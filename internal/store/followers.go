@@ -46,7 +46,7 @@ func (f *FollowersStore) Follow(ctx context.Context, followingId, userId int64)
 func (f *FollowersStore) Unfollow(ctx context.Context, followingId, userId int64) error {
 	query := `
 	DELETE from followers
-	WHERE user_id = $1, follower_id = $2
+	WHERE user_id = $1 AND follower_id = $2
 	`
 
 	res, err := f.db.ExecContext(ctx, query, userId, followingId)
@@ -71,3 +71,119 @@ func (f *FollowersStore) Unfollow(ctx context.Context, followingId, userId int64
 	return nil
 
 }
+
+// FollowUser is an entry of a follower list: the user on the other side of
+// the relationship and when it started.
+type FollowUser struct {
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	FollowedAt string `json:"followed_at"`
+}
+
+// GetFollowers pages through the users following userID, most recent first
+// by default.
+func (f *FollowersStore) GetFollowers(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]FollowUser, Page, error) {
+	return f.list(ctx, "follower_id", "user_id", userID, fq)
+}
+
+// GetFollowing pages through the users userID follows.
+func (f *FollowersStore) GetFollowing(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]FollowUser, Page, error) {
+	return f.list(ctx, "user_id", "follower_id", userID, fq)
+}
+
+// list joins the users on the other column of the relationships whose
+// column equals userID.
+func (f *FollowersStore) list(ctx context.Context, other, column string, userID int64, fq PaginatedFeedQuery) ([]FollowUser, Page, error) {
+	ks := fq.keysetClause("f.created_at", "u.id", 4)
+
+	query := `
+	SELECT u.id, u.username, f.created_at
+	FROM followers f
+	JOIN users u ON u.id = f.` + other + ` AND u.is_active = true
+	WHERE f.` + column + ` = $1 AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	args := append([]any{userID, fq.Limit + 1, ks.offset}, ks.args...)
+
+	rows, err := f.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	defer rows.Close()
+
+	users := []FollowUser{}
+
+	for rows.Next() {
+		var u FollowUser
+
+		if err := rows.Scan(&u.ID, &u.Username, &u.FollowedAt); err != nil {
+			return nil, Page{}, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	users, page := Paginate(users, fq, func(u FollowUser) (string, int64) {
+		return u.FollowedAt, u.ID
+	})
+
+	return users, page, nil
+}
+
+// GetFollowerIDs returns the IDs of the active users following userID.
+func (f *FollowersStore) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+	SELECT f.follower_id
+	FROM followers f
+	JOIN users u ON u.id = f.follower_id AND u.is_active = true
+	WHERE f.user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := f.db.QueryContext(ctx, query, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// CountFollowers returns how many users follow userID.
+func (f *FollowersStore) CountFollowers(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM followers WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+
+	err := f.db.QueryRowContext(ctx, query, userID).Scan(&count)
+
+	return count, err
+}
@@ -32,6 +32,9 @@ func (m *MockUserStore) GetByEmail(ctx context.Context, email string) (*User, er
 func (m *MockUserStore) CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error {
 	return nil
 }
-func (m *MockUserStore) Activate(ctx context.Context, token string) error {
+func (m *MockUserStore) Activate(ctx context.Context, token string) (int64, error) {
+	return 0, nil
+}
+func (m *MockUserStore) SetAvatar(ctx context.Context, userID int64, attachmentID *int64) error {
 	return nil
 }
@@ -1,20 +1,126 @@
 package store
 
 import (
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rpstvs/social/internal/cursor"
+	"github.com/rpstvs/social/internal/entities"
 )
 
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1, lte=20"`
+	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
 	Sort   string   `json:"sort" validate:"oneof=asc desc"`
 	Tags   []string `json:"tags" validate:"max=5"`
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	// Cursor, when set, replaces Offset on lists supporting keyset
+	// pagination. Offset is kept as a deprecated fallback.
+	Cursor *cursor.Cursor `json:"-"`
+}
+
+// Page holds the cursors around a page of a keyset-paginated list; a nil
+// cursor means there is nothing more in that direction.
+type Page struct {
+	Next *cursor.Cursor
+	Prev *cursor.Cursor
+}
+
+// keyset is the paging clause of a list ordered by a time column and an ID
+// column breaking ties.
+type keyset struct {
+	cond   string
+	order  string
+	args   []any
+	offset int
+}
+
+// keysetClause pages on (timeCol, idCol) from the cursor of the query,
+// numbering its placeholders from next. It falls back to the offset when
+// there is no cursor. Paging backwards reads the rows in reverse order, to be
+// flipped by Paginate.
+func (fq PaginatedFeedQuery) keysetClause(timeCol, idCol string, next int) keyset {
+	return fq.keysetOn(timeCol, idCol, "timestamptz", next)
+}
+
+// keysetOn is keysetClause over a column of any type, the cursor holding its
+// value as text.
+func (fq PaginatedFeedQuery) keysetOn(col, idCol, typ string, next int) keyset {
+	desc := fq.Sort != "asc"
+
+	if fq.Cursor == nil {
+		dir := "ASC"
+
+		if desc {
+			dir = "DESC"
+		}
+
+		return keyset{
+			cond:   "TRUE",
+			order:  col + " " + dir + ", " + idCol + " " + dir,
+			offset: fq.Offset,
+		}
+	}
+
+	// walking the list in descending order, unless sort and direction
+	// cancel each other out
+	descending := desc != fq.Cursor.Before
+
+	op, dir := ">", "ASC"
+
+	if descending {
+		op, dir = "<", "DESC"
+	}
+
+	return keyset{
+		cond:  fmt.Sprintf("(%s, %s) %s ($%d::%s, $%d)", col, idCol, op, next, typ, next+1),
+		order: col + " " + dir + ", " + idCol + " " + dir,
+		args:  []any{fq.Cursor.At, fq.Cursor.ID},
+	}
+}
+
+// Paginate trims the extra item read to detect a following page, restores
+// the order of backward pages and computes the cursors around the page.
+// items must be in keyset order and hold up to fq.Limit+1 entries.
+func Paginate[T any](items []T, fq PaginatedFeedQuery, key func(T) (string, int64)) ([]T, Page) {
+	var page Page
+
+	more := len(items) > fq.Limit
+
+	if more {
+		items = items[:fq.Limit]
+	}
+
+	backward := fq.Cursor != nil && fq.Cursor.Before
+
+	if backward {
+		slices.Reverse(items)
+	}
+
+	if len(items) == 0 {
+		return items, page
+	}
+
+	first, last := items[0], items[len(items)-1]
+
+	firstAt, firstID := key(first)
+	lastAt, lastID := key(last)
+
+	if more && !backward || fq.Cursor != nil && backward {
+		page.Next = &cursor.Cursor{At: lastAt, ID: lastID}
+	}
+
+	if more && backward || fq.Cursor != nil && !backward || fq.Cursor == nil && fq.Offset > 0 {
+		page.Prev = &cursor.Cursor{At: firstAt, ID: firstID, Before: true}
+	}
+
+	return items, page
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -29,8 +135,8 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		}
 		fq.Limit = l
 	}
-	offset := qs.Get("limit")
-	if limit != "" {
+	offset := qs.Get("offset")
+	if offset != "" {
 		l, err := strconv.Atoi(offset)
 		if err != nil {
 			return fq, err
@@ -39,7 +145,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	}
 
 	sort := qs.Get("sort")
-	if limit != "" {
+	if sort != "" {
 
 		fq.Sort = sort
 	}
@@ -47,12 +153,12 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	tags := qs.Get("tags")
 
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = entities.NormalizeTags(strings.Split(tags, ","))
 	}
 
 	search := qs.Get("search")
 
-	if tags != "" {
+	if search != "" {
 		fq.Search = search
 	}
 
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/rpstvs/social/internal/cursor"
+)
+
+func TestPaginate(t *testing.T) {
+	key := func(id int64) (string, int64) { return "t" + strconv.FormatInt(id, 10), id }
+	next := func(id int64) *cursor.Cursor { return &cursor.Cursor{At: "t" + strconv.FormatInt(id, 10), ID: id} }
+	prev := func(id int64) *cursor.Cursor {
+		return &cursor.Cursor{At: "t" + strconv.FormatInt(id, 10), ID: id, Before: true}
+	}
+
+	forward := &cursor.Cursor{At: "t2", ID: 2}
+	backward := &cursor.Cursor{At: "t5", ID: 5, Before: true}
+
+	tests := []struct {
+		name  string
+		items []int64
+		fq    PaginatedFeedQuery
+		want  []int64
+		page  Page
+	}{
+		{"first page", []int64{1, 2, 3}, PaginatedFeedQuery{Limit: 2}, []int64{1, 2}, Page{Next: next(2)}},
+		{"only page", []int64{1, 2}, PaginatedFeedQuery{Limit: 2}, []int64{1, 2}, Page{}},
+		{"offset page", []int64{3, 4, 5}, PaginatedFeedQuery{Limit: 2, Offset: 2}, []int64{3, 4}, Page{Next: next(4), Prev: prev(3)}},
+		{"forward page", []int64{3, 4, 5}, PaginatedFeedQuery{Limit: 2, Cursor: forward}, []int64{3, 4}, Page{Next: next(4), Prev: prev(3)}},
+		{"last page", []int64{3}, PaginatedFeedQuery{Limit: 2, Cursor: forward}, []int64{3}, Page{Prev: prev(3)}},
+		// read in reverse
+		{"backward page", []int64{4, 3, 2}, PaginatedFeedQuery{Limit: 2, Cursor: backward}, []int64{3, 4}, Page{Next: next(4), Prev: prev(3)}},
+		{"back to the first page", []int64{2, 1}, PaginatedFeedQuery{Limit: 2, Cursor: backward}, []int64{1, 2}, Page{Next: next(2)}},
+		{"past the end", nil, PaginatedFeedQuery{Limit: 2, Cursor: forward}, nil, Page{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, page := Paginate(tt.items, tt.fq, key)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("items = %v, want %v", got, tt.want)
+			}
+
+			if !sameCursor(page.Next, tt.page.Next) || !sameCursor(page.Prev, tt.page.Prev) {
+				t.Errorf("page = %+v, %+v, want %+v, %+v", page.Next, page.Prev, tt.page.Next, tt.page.Prev)
+			}
+		})
+	}
+}
+
+func sameCursor(a, b *cursor.Cursor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	defaults := PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    PaginatedFeedQuery
+		wantErr bool
+	}{
+		{"defaults", "", defaults, false},
+		{"paging", "limit=5&offset=10&sort=asc", PaginatedFeedQuery{Limit: 5, Offset: 10, Sort: "asc"}, false},
+		{"tags normalized", "tags=Go,%23go,rust", PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"go", "rust"}}, false},
+		{
+			"time range",
+			"since=2026-10-01+00:00:00&until=yesterday",
+			PaginatedFeedQuery{Limit: 20, Sort: "desc", Since: "2026-10-01 00:00:00"},
+			false,
+		},
+		{"malformed limit", "limit=ten", defaults, true},
+		{"malformed offset", "offset=-", defaults, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaults.Parse(httptest.NewRequest(http.MethodGet, "/v1/users/feed?"+tt.query, nil))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %+v, want an error", tt.query, got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Limit != tt.want.Limit || got.Offset != tt.want.Offset || got.Sort != tt.want.Sort ||
+				!slices.Equal(got.Tags, tt.want.Tags) || got.Since != tt.want.Since || got.Until != tt.want.Until {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollClosed     = errors.New("poll is closed")
+	ErrInvalidChoices = errors.New("invalid poll choices")
+)
+
+// Poll is attached to a post at creation and cannot be edited afterwards.
+// Unless PublicResults is set, counts are withheld from viewers who neither
+// voted nor wrote the post until the poll expires.
+type Poll struct {
+	ID            int64        `json:"id"`
+	PostID        int64        `json:"-"`
+	Multiple      bool         `json:"multiple"`
+	PublicResults bool         `json:"public_results"`
+	ExpiresAt     string       `json:"expires_at"`
+	Expired       bool         `json:"expired"`
+	VotersCount   *int         `json:"voters_count,omitempty"`
+	Options       []PollOption `json:"options"`
+	Voted         bool         `json:"voted"`
+	OwnVotes      []int64      `json:"own_votes,omitempty"`
+	ResultsHidden bool         `json:"results_hidden"`
+}
+
+type PollOption struct {
+	ID         int64  `json:"id"`
+	Text       string `json:"text"`
+	VotesCount *int   `json:"votes_count,omitempty"`
+}
+
+type PollsStore struct {
+	db *sql.DB
+}
+
+// Vote records the user's choices. Single choice polls take exactly one
+// option; a user can only vote once per poll.
+func (s *PollsStore) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var (
+			pollID   int64
+			multiple bool
+			open     bool
+		)
+
+		query := `
+		SELECT id, multiple, expires_at > NOW()
+		FROM polls
+		WHERE post_id = $1`
+
+		err := tx.QueryRowContext(ctx, query, postID).Scan(&pollID, &multiple, &open)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if !open {
+			return ErrPollClosed
+		}
+
+		if len(optionIDs) == 0 || (!multiple && len(optionIDs) > 1) {
+			return ErrInvalidChoices
+		}
+
+		query = `
+		INSERT INTO poll_voters (poll_id, user_id)
+		VALUES($1,$2)`
+
+		if _, err := tx.ExecContext(ctx, query, pollID, userID); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		query = `
+		WITH chosen AS (
+			INSERT INTO poll_votes (poll_id, user_id, option_id)
+			SELECT $1, $2, o.id FROM poll_options o
+			WHERE o.poll_id = $1 AND o.id = ANY($3)
+			RETURNING option_id
+		)
+		UPDATE poll_options
+		SET votes_count = votes_count + 1
+		WHERE id IN (SELECT option_id FROM chosen)`
+
+		res, err := tx.ExecContext(ctx, query, pollID, userID, pq.Array(optionIDs))
+
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+
+		if err != nil {
+			return err
+		}
+
+		if rows != int64(len(optionIDs)) {
+			return ErrInvalidChoices
+		}
+
+		query = `
+		UPDATE polls
+		SET voters_count = voters_count + 1
+		WHERE id = $1`
+
+		_, err = tx.ExecContext(ctx, query, pollID)
+
+		return err
+	})
+}
+
+func createPoll(ctx context.Context, tx *sql.Tx, post *Post) error {
+	poll := post.Poll
+	poll.PostID = post.ID
+
+	query := `
+	INSERT INTO polls (post_id, multiple, public_results, expires_at)
+	VALUES($1,$2,$3,$4)
+	RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(ctx, query, post.ID, poll.Multiple, poll.PublicResults, poll.ExpiresAt).Scan(&poll.ID)
+
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO poll_options (poll_id, position, text)
+	VALUES($1,$2,$3)
+	RETURNING id`
+
+	zero := 0
+	poll.VotersCount = &zero
+
+	for i := range poll.Options {
+		o := &poll.Options[i]
+		o.VotesCount = &zero
+
+		if err := tx.QueryRowContext(ctx, query, poll.ID, i, o.Text).Scan(&o.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPollsByPosts loads the polls of several posts at once, keyed by post ID,
+// with the viewer's own votes and results hidden as configured.
+func getPollsByPosts(ctx context.Context, db *sql.DB, postIDs []int64, viewerID int64) (map[int64]*Poll, error) {
+	query := `
+	SELECT pl.id, pl.post_id, p.user_id, pl.multiple, pl.public_results, pl.voters_count,
+		pl.expires_at, pl.expires_at <= NOW(),
+		o.id, o.text, o.votes_count,
+		EXISTS (SELECT 1 FROM poll_votes v WHERE v.option_id = o.id AND v.user_id = $2)
+	FROM polls pl
+	JOIN posts p ON p.id = pl.post_id
+	JOIN poll_options o ON o.poll_id = pl.id
+	WHERE pl.post_id = ANY($1)
+	ORDER BY pl.post_id, o.position`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(postIDs), viewerID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	polls := make(map[int64]*Poll)
+	authors := make(map[int64]int64)
+
+	for rows.Next() {
+		var (
+			poll     Poll
+			authorID int64
+			voters   int
+			option   PollOption
+			votes    int
+			chosen   bool
+		)
+
+		err := rows.Scan(&poll.ID, &poll.PostID, &authorID, &poll.Multiple, &poll.PublicResults, &voters, &poll.ExpiresAt, &poll.Expired, &option.ID, &option.Text, &votes, &chosen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		existing, ok := polls[poll.PostID]
+
+		if !ok {
+			poll.VotersCount = &voters
+			existing = &poll
+			polls[poll.PostID] = existing
+			authors[poll.PostID] = authorID
+		}
+
+		option.VotesCount = &votes
+		existing.Options = append(existing.Options, option)
+
+		if chosen {
+			existing.Voted = true
+			existing.OwnVotes = append(existing.OwnVotes, option.ID)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for postID, poll := range polls {
+		if poll.PublicResults || poll.Expired || poll.Voted || authors[postID] == viewerID {
+			continue
+		}
+
+		poll.ResultsHidden = true
+		poll.VotersCount = nil
+
+		for i := range poll.Options {
+			poll.Options[i].VotesCount = nil
+		}
+	}
+
+	return polls, nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// PostRevision is a snapshot of a post's title and content as it was before
+// the edit that produced the next version.
+type PostRevision struct {
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	Version   int    `json:"version"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	EditedBy  *int64 `json:"edited_by"`
+	CreatedAt string `json:"created_at"`
+}
+
+type RevisionsStore struct {
+	db *sql.DB
+}
+
+func (s *RevisionsStore) GetByPost(ctx context.Context, postID int64) ([]PostRevision, error) {
+	query := `
+	SELECT id, post_id, version, title, content, edited_by, created_at
+	FROM post_revisions
+	WHERE post_id = $1
+	ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+
+	for rows.Next() {
+		var rev PostRevision
+
+		err := rows.Scan(&rev.ID, &rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.EditedBy, &rev.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *RevisionsStore) GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `
+	SELECT id, post_id, version, title, content, edited_by, created_at
+	FROM post_revisions
+	WHERE post_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var rev PostRevision
+
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(&rev.ID, &rev.PostID, &rev.Version, &rev.Title, &rev.Content, &rev.EditedBy, &rev.CreatedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+// createRevision keeps the current title and content of the post when the
+// update is about to change them. Status-only updates are not recorded.
+func createRevision(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `
+	INSERT INTO post_revisions (post_id, version, title, content, edited_by)
+	SELECT id, version, title, content, $5
+	FROM posts
+	WHERE id = $1 AND version = $2 AND (title, content) IS DISTINCT FROM ($3, $4)
+	ON CONFLICT (post_id, version) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var editedBy *int64
+
+	if post.EditorID != 0 {
+		editedBy = &post.EditorID
+	}
+
+	_, err := tx.ExecContext(ctx, query, post.ID, post.Version, post.Title, post.Content, editedBy)
+
+	return err
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/rpstvs/social/internal/search"
+)
+
+// searchConfig is the text search configuration the search vectors are built
+// with, created by the search migration.
+const searchConfig = "social"
+
+// CommentSearchResult is a comment matching a search, with its relevance and
+// an HTML snippet of its content where the matches are wrapped in <mark>
+// tags.
+type CommentSearchResult struct {
+	Comment
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type UserSearchResult struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// SearchComments returns the comments matching the query on posts readable
+// by the viewer, most relevant first.
+func (s *SearchStore) SearchComments(ctx context.Context, viewerID int64, q string, fq PaginatedFeedQuery) ([]CommentSearchResult, Page, error) {
+	ks := fq.keysetOn("h.rank", "h.id", "float8", 5)
+
+	query := `
+	SELECT h.id, h.rank, ts_headline('` + searchConfig + `', h.content, h.query, '` + search.HeadlineOptions + `'),
+		h.post_id, h.user_id, h.username, h.content, h.created_at
+	FROM (
+		SELECT c.id, c.post_id, c.user_id, u.username, c.content, c.created_at, tq.query,
+			ts_rank_cd(c.search_vector, tq.query)::float8 AS rank
+		FROM comments c
+		JOIN users u ON u.id = c.user_id AND u.is_active = true
+		JOIN posts p ON p.id = c.post_id,
+		websearch_to_tsquery('` + searchConfig + `', $1) tq(query)
+		WHERE c.search_vector @@ tq.query AND ` + visibleTo("p", "$2") + `
+	) h
+	WHERE ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	args := append([]any{q, viewerID, fq.Limit + 1, ks.offset}, ks.args...)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	defer rows.Close()
+
+	results := []CommentSearchResult{}
+
+	for rows.Next() {
+		var r CommentSearchResult
+
+		err := rows.Scan(&r.ID, &r.Rank, &r.Snippet, &r.PostID, &r.UserID, &r.User.Username, &r.Content, &r.Created_at)
+
+		if err != nil {
+			return nil, Page{}, err
+		}
+
+		r.User.ID = r.UserID
+		r.Snippet = search.Highlight(r.Snippet)
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	results, page := Paginate(results, fq, func(r CommentSearchResult) (string, int64) {
+		return strconv.FormatFloat(r.Rank, 'g', -1, 64), r.ID
+	})
+
+	return results, page, nil
+}
+
+// SearchUsers returns the active users whose username starts with the
+// query, case insensitively, in alphabetical order by default.
+func (s *SearchStore) SearchUsers(ctx context.Context, q string, fq PaginatedFeedQuery) ([]UserSearchResult, Page, error) {
+	ks := fq.keysetOn("lower(u.username)", "u.id", "text", 4)
+
+	query := `
+	SELECT u.id, u.username
+	FROM users u
+	WHERE u.is_active = true AND lower(u.username) LIKE $1 AND ` + ks.cond + `
+	ORDER BY ` + ks.order + `
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	args := append([]any{likePrefix(strings.ToLower(q)), fq.Limit + 1, ks.offset}, ks.args...)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	defer rows.Close()
+
+	users := []UserSearchResult{}
+
+	for rows.Next() {
+		var u UserSearchResult
+
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, Page{}, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+
+	users, page := Paginate(users, fq, func(u UserSearchResult) (string, int64) {
+		return strings.ToLower(u.Username), u.ID
+	})
+
+	return users, page, nil
+}
+
+// likePrefix turns s into a LIKE pattern matching the strings starting with
+// it.
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
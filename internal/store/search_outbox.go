@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxSearchSyncAttempts is how many times an outbox entry is claimed before
+// it is given up on.
+const maxSearchSyncAttempts = 5
+
+// SearchSync asks for the search document of a post to be refreshed.
+type SearchSync struct {
+	ID     int64
+	PostID int64
+}
+
+// SearchDocument is the searchable part of a post that is published and not
+// in the trash. Plain reposts have none.
+type SearchDocument struct {
+	PostID      int64
+	UserID      int64
+	Title       string
+	Content     string
+	Tags        []string
+	PublishedAt time.Time
+	Version     int64
+}
+
+// enqueueSearchSync records, in the transaction changing it, that the
+// search document of the post must be refreshed.
+func enqueueSearchSync(ctx context.Context, tx *sql.Tx, postID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO search_outbox (post_id) VALUES ($1)`, postID)
+
+	return err
+}
+
+// ClaimSearchSyncs leases up to limit outbox entries, oldest first, so that
+// they are not handed to another worker before the lease expires. Entries
+// must be acknowledged once synced. Entries failing too many times are left
+// in the outbox for inspection; a reindex covers them.
+func (s *SearchStore) ClaimSearchSyncs(ctx context.Context, limit int, lease time.Duration) ([]SearchSync, error) {
+	query := `
+	UPDATE search_outbox
+	SET locked_until = NOW() + make_interval(secs => $2), attempts = attempts + 1
+	WHERE id IN (
+		SELECT id FROM search_outbox
+		WHERE (locked_until IS NULL OR locked_until < NOW()) AND attempts < $3
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, post_id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, lease.Seconds(), maxSearchSyncAttempts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var syncs []SearchSync
+
+	for rows.Next() {
+		var sync SearchSync
+
+		if err := rows.Scan(&sync.ID, &sync.PostID); err != nil {
+			return nil, err
+		}
+
+		syncs = append(syncs, sync)
+	}
+
+	return syncs, rows.Err()
+}
+
+// AckSearchSyncs removes synced outbox entries.
+func (s *SearchStore) AckSearchSyncs(ctx context.Context, ids []int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM search_outbox WHERE id = ANY($1)`, pq.Array(ids))
+
+	return err
+}
+
+// GetSearchDocuments returns the documents of the posts among postIDs that
+// have one.
+func (s *SearchStore) GetSearchDocuments(ctx context.Context, postIDs []int64) ([]SearchDocument, error) {
+	return s.searchDocuments(ctx, `AND p.id = ANY($1) ORDER BY p.id`, pq.Array(postIDs))
+}
+
+// ListSearchDocuments pages through every document by post ID, returning up
+// to limit documents of posts after afterID.
+func (s *SearchStore) ListSearchDocuments(ctx context.Context, afterID int64, limit int) ([]SearchDocument, error) {
+	return s.searchDocuments(ctx, `AND p.id > $1 ORDER BY p.id LIMIT $2`, afterID, limit)
+}
+
+func (s *SearchStore) searchDocuments(ctx context.Context, filter string, args ...any) ([]SearchDocument, error) {
+	query := `
+	SELECT p.id, p.user_id, p.title, p.content, p.tags, p.published_at, COALESCE(p.version, 0)
+	FROM posts p
+	WHERE p.status = 'published' AND p.deleted_at IS NULL AND NOT p.is_repost ` + filter
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var docs []SearchDocument
+
+	for rows.Next() {
+		var d SearchDocument
+
+		if err := rows.Scan(&d.PostID, &d.UserID, &d.Title, &d.Content, pq.Array(&d.Tags), &d.PublishedAt, &d.Version); err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, d)
+	}
+
+	return docs, rows.Err()
+}
@@ -10,6 +10,7 @@ import (
 var (
 	ErrNotFound          = errors.New("record not found")
 	ErrConflict          = errors.New("resource already exists")
+	ErrEditConflict      = errors.New("resource was modified concurrently")
 	QueryTimeoutDuration = time.Second * 5
 )
 
@@ -17,38 +18,110 @@ type Storage struct {
 	Posts interface {
 		Create(ctx context.Context, post *Post) error
 		GetById(ctx context.Context, id int64) (*Post, error)
-		DeletePost(ctx context.Context, id int64) error
+		GetVisibleById(ctx context.Context, id, viewerID int64) (*Post, error)
+		GetByIds(ctx context.Context, ids []int64, viewerID int64) ([]Post, error)
+		DeletePost(ctx context.Context, id, deletedBy int64, version string) error
+		Restore(ctx context.Context, id int64, retention time.Duration) error
+		GetDeletedById(ctx context.Context, id int64) (*Post, error)
+		GetTrash(ctx context.Context, userID *int64, retention time.Duration, fq PaginatedFeedQuery) ([]Post, error)
+		PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int, error)
+		Unrepost(ctx context.Context, userID, originalID int64) error
 		Update(ctx context.Context, post *Post) error
-		GetUserFeed(ctx context.Context, id int64, Pag PaginatedFeedQuery) ([]PostWithMetaData, error)
+		GetUserFeed(ctx context.Context, id int64, Pag PaginatedFeedQuery) ([]PostWithMetaData, Page, error)
+		GetFeedByIds(ctx context.Context, viewerID int64, ids []int64, latest bool) ([]PostWithMetaData, error)
+		GetFeedEntries(ctx context.Context, userID int64, threshold int, pushed bool, fq PaginatedFeedQuery) ([]FeedEntry, error)
+		GetHydratedByIds(ctx context.Context, ids []int64, viewerID int64) ([]Post, error)
+		GetPublicTimeline(ctx context.Context, viewerID int64, fq PaginatedFeedQuery) ([]Post, Page, error)
+		GetByTag(ctx context.Context, tag string, viewerID int64, fq PaginatedFeedQuery) ([]Post, Page, error)
+		GetMentioning(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]Post, Page, error)
+		GetDrafts(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]Post, error)
+		PublishDue(ctx context.Context, limit int) ([]int64, error)
 	}
 	Users interface {
 		Create(ctx context.Context, tx *sql.Tx, user *User) error
 		GetById(ctx context.Context, id int64) (*User, error)
 		GetByEmail(ctx context.Context, email string) (*User, error)
 		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error
-		Activate(ctx context.Context, token string) error
+		Activate(ctx context.Context, token string) (int64, error)
+		SetAvatar(ctx context.Context, userID int64, attachmentID *int64) error
 	}
 	Comments interface {
 		GetById(ctx context.Context, id int64) (*[]Comment, error)
 		Create(ctx context.Context, comment *Comment) error
+		GetByPost(ctx context.Context, postID int64, fq PaginatedFeedQuery) ([]Comment, Page, error)
 	}
 	Followers interface {
 		Follow(ctx context.Context, followingId, userId int64) error
 		Unfollow(ctx context.Context, followingId, userId int64) error
+		GetFollowers(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]FollowUser, Page, error)
+		GetFollowing(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]FollowUser, Page, error)
+		GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error)
+		CountFollowers(ctx context.Context, userID int64) (int, error)
 	}
 
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Revisions interface {
+		GetByPost(ctx context.Context, postID int64) ([]PostRevision, error)
+		GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error)
+	}
+	Attachments interface {
+		Create(ctx context.Context, attachment *Attachment) error
+		GetOrphans(ctx context.Context, olderThan time.Duration, limit int) ([]Attachment, error)
+		Delete(ctx context.Context, id int64) error
+		ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]Attachment, error)
+		CompleteProcessing(ctx context.Context, attachment *Attachment) error
+		FailProcessing(ctx context.Context, id int64, retry bool) error
+		KeepOriginal(ctx context.Context, id int64, url string) error
+		GetMediaAccess(ctx context.Context, key string, viewerID int64) (*MediaAccess, error)
+	}
+	Polls interface {
+		Vote(ctx context.Context, postID, userID int64, optionIDs []int64) error
+	}
+	Tags interface {
+		GetByName(ctx context.Context, name string, viewerID int64) (*Tag, error)
+		Follow(ctx context.Context, userID int64, name string) error
+		Unfollow(ctx context.Context, userID int64, name string) error
+	}
+	Engagement interface {
+		GetTrendingPosts(ctx context.Context, q TrendingQuery) ([]TrendingScore, error)
+		GetTrendingTags(ctx context.Context, q TrendingQuery) ([]TrendingScore, error)
+		GetRankingCandidates(ctx context.Context, userID int64, since, until time.Time, fq PaginatedFeedQuery, limit int) ([]RankingCandidate, error)
+	}
+	Bookmarks interface {
+		CreateCollection(ctx context.Context, collection *BookmarkCollection) error
+		GetCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error)
+		DeleteCollection(ctx context.Context, userID, collectionID int64) error
+		Add(ctx context.Context, userID, postID int64, collectionID *int64) error
+		Remove(ctx context.Context, userID, postID int64) error
+		GetBookmarks(ctx context.Context, userID int64, collectionID *int64, fq PaginatedFeedQuery) ([]Bookmark, error)
+		IsBookmarked(ctx context.Context, userID, postID int64) (bool, error)
+	}
+	Search interface {
+		SearchComments(ctx context.Context, viewerID int64, q string, fq PaginatedFeedQuery) ([]CommentSearchResult, Page, error)
+		SearchUsers(ctx context.Context, q string, fq PaginatedFeedQuery) ([]UserSearchResult, Page, error)
+		ClaimSearchSyncs(ctx context.Context, limit int, lease time.Duration) ([]SearchSync, error)
+		AckSearchSyncs(ctx context.Context, ids []int64) error
+		GetSearchDocuments(ctx context.Context, postIDs []int64) ([]SearchDocument, error)
+		ListSearchDocuments(ctx context.Context, afterID int64, limit int) ([]SearchDocument, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostsStore{db: db},
-		Users:     &UsersStore{db: db},
-		Comments:  &CommentsStore{db: db},
-		Followers: &FollowersStore{db: db},
-		Roles:     &RoleStore{db: db},
+		Posts:       &PostsStore{db: db},
+		Users:       &UsersStore{db: db},
+		Comments:    &CommentsStore{db: db},
+		Followers:   &FollowersStore{db: db},
+		Roles:       &RoleStore{db: db},
+		Bookmarks:   &BookmarksStore{db: db},
+		Revisions:   &RevisionsStore{db: db},
+		Attachments: &AttachmentsStore{db: db},
+		Polls:       &PollsStore{db: db},
+		Tags:        &TagsStore{db: db},
+		Engagement:  &EngagementStore{db: db},
+		Search:      &SearchStore{db: db},
 	}
 }
 
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Tag describes a normalized tag. PostCount only counts public published
+// posts, the ones anybody can find on the tag page.
+type Tag struct {
+	Name        string `json:"name"`
+	PostCount   int    `json:"post_count"`
+	FirstSeenAt string `json:"first_seen_at"`
+	Following   bool   `json:"following"`
+}
+
+type TagsStore struct {
+	db *sql.DB
+}
+
+func (s *TagsStore) GetByName(ctx context.Context, name string, viewerID int64) (*Tag, error) {
+	query := `
+	SELECT t.name, t.first_seen_at,
+		(SELECT COUNT(*) FROM posts p
+			WHERE p.tags @> ARRAY[t.name] AND p.visibility = 'public'
+				AND p.status = 'published' AND p.deleted_at IS NULL),
+		EXISTS (SELECT 1 FROM tag_follows f WHERE f.tag = t.name AND f.user_id = $2)
+	FROM tags t
+	WHERE t.name = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var tag Tag
+
+	err := s.db.QueryRowContext(ctx, query, name, viewerID).Scan(&tag.Name, &tag.FirstSeenAt, &tag.PostCount, &tag.Following)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tag, nil
+}
+
+func (s *TagsStore) Follow(ctx context.Context, userID int64, name string) error {
+	query := `
+	INSERT INTO tag_follows (user_id, tag)
+	VALUES($1,$2)
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, name)
+	return err
+}
+
+func (s *TagsStore) Unfollow(ctx context.Context, userID int64, name string) error {
+	query := `
+	DELETE FROM tag_follows
+	WHERE user_id = $1 AND tag = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, name)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// recordTags remembers when each tag was first used.
+func recordTags(ctx context.Context, tx *sql.Tx, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO tags (name)
+	SELECT unnest($1::text[])
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(tags))
+	return err
+}
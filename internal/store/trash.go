@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DeletePost moves the post to the trash. It disappears from every read path
+// but can be restored until PurgeDeleted removes it for good. A non-empty
+// version only deletes the post at that version, failing with
+// ErrEditConflict otherwise.
+func (s *PostsStore) DeletePost(ctx context.Context, id, deletedBy int64, version string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE posts
+		SET deleted_at = NOW(), deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL AND ($3 = '' OR version::text = $3)
+		RETURNING repost_of_id`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var repostOfID *int64
+
+		err := tx.QueryRowContext(ctx, query, id, deletedBy, version).Scan(&repostOfID)
+
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows) && version != "":
+				return s.editConflictOrNotFound(ctx, tx, id)
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := enqueueSearchSync(ctx, tx, id); err != nil {
+			return err
+		}
+
+		if repostOfID != nil {
+			return s.incrementRepostCount(ctx, tx, *repostOfID, -1)
+		}
+
+		return nil
+	})
+}
+
+// editConflictOrNotFound tells why a versioned write on a live post matched
+// no row: it is gone, or at another version.
+func (s *PostsStore) editConflictOrNotFound(ctx context.Context, tx *sql.Tx, id int64) error {
+	var exists bool
+
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrEditConflict
+	}
+
+	return ErrNotFound
+}
+
+// Restore takes a post out of the trash as long as it was deleted within the
+// retention window.
+func (s *PostsStore) Restore(ctx context.Context, id int64, retention time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE posts
+		SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND deleted_at > NOW() - make_interval(secs => $2)
+		RETURNING repost_of_id`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var repostOfID *int64
+
+		err := tx.QueryRowContext(ctx, query, id, retention.Seconds()).Scan(&repostOfID)
+
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := enqueueSearchSync(ctx, tx, id); err != nil {
+			return err
+		}
+
+		if repostOfID != nil {
+			return s.incrementRepostCount(ctx, tx, *repostOfID, 1)
+		}
+
+		return nil
+	})
+}
+
+// GetDeletedById returns a post in the trash.
+func (s *PostsStore) GetDeletedById(ctx context.Context, id int64) (*Post, error) {
+	query := `
+	SELECT id, content, title, user_id, tags, version, created_at, updated_at, visibility, status, deleted_at, deleted_by
+	FROM posts
+	WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var post Post
+
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.Version, &post.CreatedAt, &post.UpdatedAt, &post.Visibility, &post.Status, &post.DeletedAt, &post.DeletedBy)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &post, nil
+}
+
+// GetTrash lists deleted posts that can still be restored, most recently
+// deleted first. A nil user lists the trash of every user.
+func (s *PostsStore) GetTrash(ctx context.Context, userID *int64, retention time.Duration, fq PaginatedFeedQuery) ([]Post, error) {
+	query := `
+	SELECT id, content, title, user_id, tags, version, created_at, updated_at, visibility, status, deleted_at, deleted_by
+	FROM posts
+	WHERE deleted_at > NOW() - make_interval(secs => $2) AND ($1::bigint IS NULL OR user_id = $1)
+	ORDER BY deleted_at ` + fq.Sort + `
+	LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, retention.Seconds(), fq.Limit, fq.Offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	trash := []Post{}
+
+	for rows.Next() {
+		var p Post
+
+		err := rows.Scan(&p.ID, &p.Content, &p.Title, &p.UserID, pq.Array(&p.Tags), &p.Version, &p.CreatedAt, &p.UpdatedAt, &p.Visibility, &p.Status, &p.DeletedAt, &p.DeletedBy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		trash = append(trash, p)
+	}
+
+	return trash, rows.Err()
+}
+
+// PurgeDeleted hard-deletes up to limit posts that stayed in the trash longer
+// than the retention window, together with their bookmarks and the plain
+// reposts pointing at them. Rows are claimed with FOR UPDATE SKIP LOCKED so
+// concurrent purgers never collide.
+func (s *PostsStore) PurgeDeleted(ctx context.Context, retention time.Duration, limit int) (int, error) {
+	var purged int
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+		SELECT id FROM posts
+		WHERE deleted_at <= NOW() - make_interval(secs => $1)
+		ORDER BY deleted_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, retention.Seconds(), limit)
+
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+
+		for rows.Next() {
+			var id int64
+
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+
+			ids = append(ids, id)
+		}
+
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		queries := []string{
+			`DELETE FROM bookmarks WHERE post_id = ANY($1)`,
+			`DELETE FROM posts WHERE repost_of_id = ANY($1) AND is_repost = true`,
+			`DELETE FROM posts WHERE id = ANY($1)`,
+		}
+
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, q, pq.Array(ids)); err != nil {
+				return err
+			}
+		}
+
+		purged = len(ids)
+		return nil
+	})
+
+	return purged, err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -25,6 +26,9 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id"`
 	Role      Role     `json:"role"`
+	AvatarID  *int64   `json:"-"`
+	// Avatar is only loaded when fetching a single user.
+	Avatar *Attachment `json:"avatar,omitempty"`
 }
 
 type Password struct {
@@ -86,12 +90,12 @@ func (s *UsersStore) GetById(ctx context.Context, id int64) (*User, error) {
 	var user User
 
 	query := `
-	SELECT id, username, email, password, created_at, roles.*
+	SELECT users.id, username, email, password, users.created_at, users.avatar_id, roles.id, roles.level, roles.name
 	from users
 	JOIN roles ON (users.role_id = roles.id)
-	WHERE id = $1 AND is_active = true;`
+	WHERE users.id = $1 AND is_active = true;`
 
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password.Hash, &user.CreatedAt, &user.Role.ID, &user.Role.Level, &user.Role.Name)
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password.Hash, &user.CreatedAt, &user.AvatarID, &user.Role.ID, &user.Role.Level, &user.Role.Name)
 
 	if err != nil {
 		switch {
@@ -103,9 +107,77 @@ func (s *UsersStore) GetById(ctx context.Context, id int64) (*User, error) {
 			return nil, err
 		}
 	}
+
+	if user.AvatarID != nil {
+		if user.Avatar, err = s.getAvatar(ctx, *user.AvatarID); err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
+func (s *UsersStore) getAvatar(ctx context.Context, attachmentID int64) (*Attachment, error) {
+	query := `
+	SELECT id, user_id, url, content_type, size, status, width, height, blurhash, created_at
+	FROM attachments
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var a Attachment
+
+	err := s.db.QueryRowContext(ctx, query, attachmentID).Scan(&a.ID, &a.UserID, &a.URL, &a.ContentType, &a.Size, &a.Status, &a.Width, &a.Height, &a.Blurhash, &a.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	avatars := []Attachment{a}
+
+	if err := loadVariants(ctx, s.db, avatars); err != nil {
+		return nil, err
+	}
+
+	return &avatars[0], nil
+}
+
+// SetAvatar makes one of the user's unattached image uploads their avatar. A
+// nil attachment removes the avatar; the previous upload is then left to the
+// media janitor.
+func (s *UsersStore) SetAvatar(ctx context.Context, userID int64, attachmentID *int64) error {
+	query := `
+	UPDATE users
+	SET avatar_id = $2
+	WHERE id = $1 AND ($2::bigint IS NULL OR EXISTS (
+		SELECT 1 FROM attachments
+		WHERE id = $2 AND user_id = $1 AND post_id IS NULL
+			AND content_type LIKE 'image/%' AND status <> 'failed'
+	))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, attachmentID)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrAttachmentUnavailable
+	}
+
+	return nil
+}
+
 func (s *UsersStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
 
@@ -161,9 +233,11 @@ func (u *UsersStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 	return nil
 }
 
-func (u *UsersStore) Activate(ctx context.Context, token string) error {
+// Activate activates the user invited with the token, returning their ID.
+func (u *UsersStore) Activate(ctx context.Context, token string) (int64, error) {
+	var userID int64
 
-	return withTx(u.db, ctx, func(tx *sql.Tx) error {
+	err := withTx(u.db, ctx, func(tx *sql.Tx) error {
 		user, err := u.getUserFromInvitation(ctx, tx, token)
 
 		if err != nil {
@@ -179,8 +253,12 @@ func (u *UsersStore) Activate(ctx context.Context, token string) error {
 		if err := u.deleteUserInvitation(ctx, tx, user.ID); err != nil {
 			return err
 		}
+
+		userID = user.ID
 		return nil
 	})
+
+	return userID, err
 }
 
 func (u *UsersStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
@@ -191,12 +269,14 @@ func (u *UsersStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, toke
 	WHERE ui.token =$1 AND ui.expiry > $2
 	`
 
-	hashToken := sha256.Sum256([]byte(token))
+	// invitations are stored under the hex encoded hash of their token
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	user := &User{}
-	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(user.ID, user.Username, user.Email, user.CreatedAt, user.IsActive)
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
 
 	if err != nil {
 		switch err {
@@ -215,7 +295,7 @@ func (u *UsersStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
 		UPDATE users
 		SET username = $1, email = $2, is_active = $3 
-		WHERE user_id = $4
+		WHERE id = $4
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
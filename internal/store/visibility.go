@@ -0,0 +1,36 @@
+package store
+
+import "fmt"
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityMentioned = "mentioned"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
+// visibleTo returns the SQL predicate deciding whether the post aliased as
+// alias can be read by the viewer bound to the viewer placeholder. Every read
+// path filters on it so followers-only and mentioned-only posts never leak,
+// drafts and scheduled posts stay private to their author and posts in the
+// trash are hidden from everyone.
+func visibleTo(alias, viewer string) string {
+	return fmt.Sprintf(`%[1]s.deleted_at IS NULL AND (
+		%[1]s.user_id = %[2]s OR (
+			%[1]s.status = 'published' AND (
+				%[1]s.visibility = 'public' OR
+				(%[1]s.visibility = 'followers' AND EXISTS (
+					SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s.user_id AND vf.follower_id = %[2]s
+				)) OR
+				(%[1]s.visibility = 'mentioned' AND EXISTS (
+					SELECT 1 FROM post_mentions vm WHERE vm.post_id = %[1]s.id AND vm.user_id = %[2]s
+				))
+			)
+		)
+	)`, alias, viewer)
+}
@@ -0,0 +1,299 @@
+// Package timeline keeps the home timelines of users in Redis, as sorted
+// sets of post IDs scored by the time the posts were published.
+package timeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Entry is a post of a timeline.
+type Entry struct {
+	PostID int64
+	At     time.Time
+}
+
+// ErrTruncated is returned by Range when the entries asked for reach past
+// the oldest one kept: the timeline was trimmed to its capacity and the older
+// entries are only found in the database.
+var ErrTruncated = errors.New("range reaches past the timeline capacity")
+
+// built marks a timeline that exists, even when it has no entries. It is
+// scored with the negated time the timeline was built at, below every post so
+// ranges by score never reach it.
+const built = "built"
+
+// staleKey holds the time before which every timeline is stale, set when a
+// post could not be pushed to the timelines it belonged to.
+const staleKey = "timeline:stale"
+
+// pushScript adds a post to a timeline that was already built and trims it
+// to its capacity. Timelines that were never built, or expired, are left
+// alone: they are rebuilt from the database when next read.
+var pushScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZREMRANGEBYRANK', KEYS[1], 1, -(tonumber(ARGV[3]) + 1))
+return 1
+`)
+
+// touchScript reports whether a timeline exists and is fresh, extending its
+// lifetime. Timelines built before the stale time are deleted, to be rebuilt
+// when read.
+var touchScript = redis.NewScript(`
+local builtAt = redis.call('ZSCORE', KEYS[1], ARGV[2])
+if not builtAt then
+	return 0
+end
+local staleAt = redis.call('GET', KEYS[2])
+if staleAt and -tonumber(builtAt) < tonumber(staleAt) then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// Store keeps up to capacity entries per timeline. Timelines expire after
+// ttl without being read.
+type Store struct {
+	rdb      *redis.Client
+	capacity int
+	ttl      time.Duration
+}
+
+func NewStore(rdb *redis.Client, capacity int, ttl time.Duration) *Store {
+	return &Store{rdb: rdb, capacity: capacity, ttl: ttl}
+}
+
+func redisKey(userID int64) string {
+	return fmt.Sprintf("timeline:%d", userID)
+}
+
+// Members are zero padded so that entries published at the same time sort by
+// post ID.
+func member(postID int64) string {
+	return fmt.Sprintf("%020d", postID)
+}
+
+func score(at time.Time) float64 {
+	return float64(at.UnixMicro())
+}
+
+// Push adds the entry to the timelines of the users that have one.
+func (s *Store) Push(ctx context.Context, userIDs []int64, e Entry) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range userIDs {
+			pushScript.Run(ctx, pipe, []string{redisKey(id)}, score(e.At), member(e.PostID), s.capacity)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Replace swaps the timeline of the user for the given entries, keeping the
+// most recent ones up to the capacity. builtAt is the time the entries were
+// read at.
+func (s *Store) Replace(ctx context.Context, userID int64, entries []Entry, builtAt time.Time) error {
+	key := redisKey(userID)
+	tmp := key + ":tmp"
+
+	members := []*redis.Z{{Score: -score(builtAt), Member: built}}
+
+	for _, e := range entries {
+		members = append(members, &redis.Z{Score: score(e.At), Member: member(e.PostID)})
+	}
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, tmp)
+		pipe.ZAdd(ctx, tmp, members...)
+		pipe.ZRemRangeByRank(ctx, tmp, 1, int64(-(s.capacity + 1)))
+		pipe.Rename(ctx, tmp, key)
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+
+	return err
+}
+
+// Invalidate drops the timeline of the user, rebuilt when next read.
+func (s *Store) Invalidate(ctx context.Context, userID int64) error {
+	return s.rdb.Del(ctx, redisKey(userID)).Err()
+}
+
+// MarkStale makes every timeline built so far be rebuilt when next read.
+func (s *Store) MarkStale(ctx context.Context) error {
+	return s.rdb.Set(ctx, staleKey, time.Now().UnixMicro(), s.ttl).Err()
+}
+
+// Range reads up to limit entries of the user's timeline past the from
+// entry, or from either end when from is nil. Entries are returned most
+// recent first, or oldest first when ascending is set. ok is false when the
+// user has no timeline, or a stale one. ErrTruncated is returned when the
+// entries past from may not all be kept.
+func (s *Store) Range(ctx context.Context, userID int64, from *Entry, ascending bool, limit int) (entries []Entry, ok bool, err error) {
+	key := redisKey(userID)
+
+	ok, err = s.touch(ctx, key)
+
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	// the built marker is scored below 0
+	rng := &redis.ZRangeBy{Min: "(0", Max: "+inf", Count: int64(limit)}
+	boundary := ""
+
+	if from != nil {
+		boundary = strconv.FormatInt(from.At.UnixMicro(), 10)
+
+		// the entries published at the same time as from are read again,
+		// then the ones up to it are dropped
+		ties, err := s.rdb.ZCount(ctx, key, boundary, boundary).Result()
+
+		if err != nil {
+			return nil, true, err
+		}
+
+		rng.Count += ties
+
+		if ascending {
+			rng.Min = boundary
+		} else {
+			rng.Max = boundary
+		}
+	}
+
+	var found []redis.Z
+
+	if ascending {
+		found, err = s.rdb.ZRangeByScoreWithScores(ctx, key, rng).Result()
+	} else {
+		found, err = s.rdb.ZRevRangeByScoreWithScores(ctx, key, rng).Result()
+	}
+
+	if err != nil {
+		return nil, true, err
+	}
+
+	for _, z := range found {
+		id, err := strconv.ParseInt(z.Member.(string), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		e := Entry{PostID: id, At: time.UnixMicro(int64(z.Score)).UTC()}
+
+		if from != nil && e.At.Equal(from.At) && (ascending && id <= from.PostID || !ascending && id >= from.PostID) {
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	// the range may only reach past the oldest entry kept when going down
+	// to the end of the timeline, or starting below it
+	if !ascending && len(entries) < limit || ascending && from != nil {
+		truncated, err := s.truncatedAt(ctx, key, from, ascending)
+
+		if err != nil {
+			return nil, true, err
+		}
+
+		if truncated {
+			return nil, true, ErrTruncated
+		}
+	}
+
+	return entries, true, nil
+}
+
+// truncatedAt reports whether the timeline was trimmed to its capacity and,
+// when going up from the from entry, whether that entry is older than the
+// oldest one kept.
+func (s *Store) truncatedAt(ctx context.Context, key string, from *Entry, ascending bool) (bool, error) {
+	count, err := s.rdb.ZCard(ctx, key).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	// the built marker is not an entry
+	if count-1 < int64(s.capacity) {
+		return false, nil
+	}
+
+	if !ascending {
+		return true, nil
+	}
+
+	oldest, err := s.rdb.ZRangeWithScores(ctx, key, 1, 1).Result()
+
+	if err != nil || len(oldest) == 0 {
+		return false, err
+	}
+
+	id, err := strconv.ParseInt(oldest[0].Member.(string), 10, 64)
+
+	if err != nil {
+		return false, err
+	}
+
+	at := time.UnixMicro(int64(oldest[0].Score))
+
+	return from.At.Before(at) || from.At.Equal(at) && from.PostID < id, nil
+}
+
+// touch reports whether the timeline exists and is fresh, extending its
+// lifetime.
+func (s *Store) touch(ctx context.Context, key string) (bool, error) {
+	return touchScript.Run(ctx, s.rdb, []string{key, staleKey}, int64(s.ttl.Seconds()), built).Bool()
+}
+
+// Merge combines entry lists sorted the same way into one, dropping the
+// posts present in several of them.
+func Merge(ascending bool, lists ...[]Entry) []Entry {
+	seen := make(map[int64]bool)
+
+	var merged []Entry
+
+	for _, list := range lists {
+		for _, e := range list {
+			if !seen[e.PostID] {
+				seen[e.PostID] = true
+				merged = append(merged, e)
+			}
+		}
+	}
+
+	slices.SortFunc(merged, func(a, b Entry) int {
+		c := a.At.Compare(b.At)
+
+		if c == 0 {
+			c = cmp.Compare(a.PostID, b.PostID)
+		}
+
+		if !ascending {
+			c = -c
+		}
+
+		return c
+	})
+
+	return merged
+}
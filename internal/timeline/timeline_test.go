@@ -0,0 +1,54 @@
+package timeline
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	tests := []struct {
+		name      string
+		ascending bool
+		lists     [][]Entry
+		want      []Entry
+	}{
+		{
+			name:  "interleaved, newest first",
+			lists: [][]Entry{{{1, at(3)}, {2, at(1)}}, {{3, at(2)}, {4, at(0)}}},
+			want:  []Entry{{1, at(3)}, {3, at(2)}, {2, at(1)}, {4, at(0)}},
+		},
+		{
+			name:      "interleaved, oldest first",
+			ascending: true,
+			lists:     [][]Entry{{{2, at(1)}, {1, at(3)}}, {{4, at(0)}, {3, at(2)}}},
+			want:      []Entry{{4, at(0)}, {2, at(1)}, {3, at(2)}, {1, at(3)}},
+		},
+		{
+			name:  "ties broken by post ID",
+			lists: [][]Entry{{{1, at(1)}}, {{3, at(1)}, {2, at(1)}}},
+			want:  []Entry{{3, at(1)}, {2, at(1)}, {1, at(1)}},
+		},
+		{
+			name:  "post in several lists kept once, from the first",
+			lists: [][]Entry{{{1, at(2)}, {2, at(1)}}, {{1, at(5)}, {3, at(0)}}},
+			want:  []Entry{{1, at(2)}, {2, at(1)}, {3, at(0)}},
+		},
+		{
+			name:  "empty lists",
+			lists: [][]Entry{nil, {}},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Merge(tt.ascending, tt.lists...); !slices.Equal(got, tt.want) {
+				t.Errorf("Merge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package trending
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store keeps the latest ranking computed for each key.
+type Store interface {
+	Replace(ctx context.Context, key string, items []Item) error
+	Top(ctx context.Context, key string, limit int) ([]Item, error)
+}
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	rankings map[string][]Item
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{rankings: make(map[string][]Item)}
+}
+
+func (s *MemoryStore) Replace(ctx context.Context, key string, items []Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rankings[key] = append([]Item(nil), items...)
+	return nil
+}
+
+func (s *MemoryStore) Top(ctx context.Context, key string, limit int) ([]Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := s.rankings[key]
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	return append([]Item(nil), items...), nil
+}
+
+// RedisStore keeps each ranking in a sorted set, shared by every API
+// instance.
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
+
+func redisKey(key string) string {
+	return "trending:" + key
+}
+
+// Replace swaps the whole ranking at once: readers either see the previous
+// one or the new one, never a mix.
+func (s *RedisStore) Replace(ctx context.Context, key string, items []Item) error {
+	tmp := redisKey(key) + ":tmp"
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, tmp)
+
+		if len(items) == 0 {
+			pipe.Del(ctx, redisKey(key))
+			return nil
+		}
+
+		members := make([]*redis.Z, len(items))
+
+		for i, item := range items {
+			members[i] = &redis.Z{Score: item.Score, Member: item.ID}
+		}
+
+		pipe.ZAdd(ctx, tmp, members...)
+		pipe.Rename(ctx, tmp, redisKey(key))
+		return nil
+	})
+
+	return err
+}
+
+func (s *RedisStore) Top(ctx context.Context, key string, limit int) ([]Item, error) {
+	members, err := s.rdb.ZRevRangeWithScores(ctx, redisKey(key), 0, int64(limit-1)).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, len(members))
+
+	for i, m := range members {
+		items[i] = Item{ID: m.Member.(string), Score: m.Score}
+	}
+
+	return items, nil
+}
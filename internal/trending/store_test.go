@@ -0,0 +1,74 @@
+package trending
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestMemoryStoreTop(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	ranking := []Item{{ID: "3", Score: 9}, {ID: "1", Score: 4}, {ID: "2", Score: 1}}
+
+	if err := s.Replace(ctx, "posts:day", ranking); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store keeps its own copy
+	ranking[0].ID = "changed"
+
+	tests := []struct {
+		name  string
+		key   string
+		limit int
+		want  []Item
+	}{
+		{"whole ranking", "posts:day", 10, []Item{{ID: "3", Score: 9}, {ID: "1", Score: 4}, {ID: "2", Score: 1}}},
+		{"limited", "posts:day", 2, []Item{{ID: "3", Score: 9}, {ID: "1", Score: 4}}},
+		{"unknown key", "posts:week", 10, []Item{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Top(ctx, tt.key, tt.limit)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Top(%s, %d) = %v, want %v", tt.key, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreReplace(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	for _, ranking := range [][]Item{{{ID: "1", Score: 2}, {ID: "2", Score: 1}}, {{ID: "3", Score: 5}}} {
+		if err := s.Replace(ctx, "tags:day", ranking); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Top(ctx, "tags:day", 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []Item{{ID: "3", Score: 5}}; !slices.Equal(got, want) {
+		t.Errorf("Top() = %v, want %v", got, want)
+	}
+
+	// a caller changing the result does not change the ranking
+	got[0].Score = 0
+
+	if again, _ := s.Top(ctx, "tags:day", 10); again[0].Score != 5 {
+		t.Errorf("Top() = %v after the caller changed a copy", again)
+	}
+}
@@ -0,0 +1,36 @@
+// Package trending ranks posts and tags by a time-decayed engagement score.
+package trending
+
+import "time"
+
+type Item struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// Window is the span of events taken into account and how fast their weight
+// decays: an event HalfLife old weighs half as much as one happening now, so
+// items gaining engagement quickly rank above ones that had more of it
+// earlier.
+type Window struct {
+	Name     string
+	Span     time.Duration
+	HalfLife time.Duration
+}
+
+var (
+	Day  = Window{Name: "day", Span: 24 * time.Hour, HalfLife: 4 * time.Hour}
+	Week = Window{Name: "week", Span: 7 * 24 * time.Hour, HalfLife: 24 * time.Hour}
+)
+
+var Windows = []Window{Day, Week}
+
+// Rules are the anti-gaming knobs applied when ranking. The events are
+// scored by the database, see store.TrendingQuery.
+type Rules struct {
+	// Weights per event kind; kinds missing from the map are ignored.
+	Weights map[string]float64
+	// MinUsers is the number of distinct users an item needs to rank at
+	// all, so nobody can trend alone.
+	MinUsers int
+}